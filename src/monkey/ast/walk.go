@@ -0,0 +1,356 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is called for each node Walk comes across. If
+// it returns a non-nil visitor w, Walk visits the children of the node
+// with w and then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node depth first, visiting children in
+// source order. The comments of a program are not part of the tree and
+// are not visited.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *LetStatement:
+		Walk(v, n.Name)
+		walkExpression(v, n.Value)
+	case *ReturnStatement:
+		walkExpression(v, n.ReturnValue)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		if n.Consequence != nil {
+			Walk(v, n.Consequence)
+		}
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+	case *MemberExpression:
+		walkExpression(v, n.Object)
+		if n.Property != nil {
+			Walk(v, n.Property)
+		}
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			walkExpression(v, pair.Key)
+			walkExpression(v, pair.Value)
+		}
+	case *Identifier, *IntegerLiteral, *Boolean, *StringLiteral, *Comment:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, stmt := range list {
+		if stmt != nil {
+			Walk(v, stmt)
+		}
+	}
+}
+
+func walkExpression(v Visitor, exp Expression) {
+	if exp != nil {
+		Walk(v, exp)
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, exp := range list {
+		walkExpression(v, exp)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node like Walk, calling f for each
+// node. If f returns true, Inspect goes on with the children of the node
+// and then calls f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite traverses the tree rooted at node and returns it transformed.
+// Either function may be nil.
+//
+// pre is called for each node before its children and returns the node to
+// put in its place and whether to rewrite the children of that node. post
+// is called after the children were rewritten and returns the final
+// replacement. Returning nil removes a statement from a list of
+// statements; elsewhere it leaves the field empty.
+//
+// Rewrite does not modify the tree it is given: a node whose children
+// change is copied, so the result shares the unchanged parts of the tree.
+// A replacement must fit its place, an Expression where an expression is
+// expected and an *Identifier where an identifier is; otherwise Rewrite
+// panics.
+func Rewrite(node Node, pre func(Node) (Node, bool), post func(Node) Node) Node {
+	r := &rewriter{pre: pre, post: post}
+	return r.rewrite(node)
+}
+
+type rewriter struct {
+	pre  func(Node) (Node, bool)
+	post func(Node) Node
+}
+
+func (r *rewriter) rewrite(node Node) Node {
+	descend := true
+	if r.pre != nil {
+		node, descend = r.pre(node)
+		if node == nil {
+			return nil
+		}
+	}
+	if descend {
+		node = r.children(node)
+	}
+	if r.post != nil {
+		node = r.post(node)
+	}
+	return node
+}
+
+// children rewrites the children of node, returning a copy of node with
+// the new children if any of them changed.
+func (r *rewriter) children(node Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		stmts, changed := r.statements(n.Statements)
+		if changed {
+			c := *n
+			c.Statements = stmts
+			return &c
+		}
+	case *LetStatement:
+		name, value := r.identifier(n.Name), r.expression(n.Value)
+		if name != n.Name || value != n.Value {
+			c := *n
+			c.Name, c.Value = name, value
+			return &c
+		}
+	case *ReturnStatement:
+		value := r.expression(n.ReturnValue)
+		if value != n.ReturnValue {
+			c := *n
+			c.ReturnValue = value
+			return &c
+		}
+	case *ExpressionStatement:
+		exp := r.expression(n.Expression)
+		if exp != n.Expression {
+			c := *n
+			c.Expression = exp
+			return &c
+		}
+	case *BlockStatement:
+		stmts, changed := r.statements(n.Statements)
+		if changed {
+			c := *n
+			c.Statements = stmts
+			return &c
+		}
+	case *PrefixExpression:
+		right := r.expression(n.Right)
+		if right != n.Right {
+			c := *n
+			c.Right = right
+			return &c
+		}
+	case *InfixExpression:
+		left, right := r.expression(n.Left), r.expression(n.Right)
+		if left != n.Left || right != n.Right {
+			c := *n
+			c.Left, c.Right = left, right
+			return &c
+		}
+	case *IfExpression:
+		cond := r.expression(n.Condition)
+		cons, alt := r.block(n.Consequence), r.block(n.Alternative)
+		if cond != n.Condition || cons != n.Consequence || alt != n.Alternative {
+			c := *n
+			c.Condition, c.Consequence, c.Alternative = cond, cons, alt
+			return &c
+		}
+	case *FunctionLiteral:
+		params, changed := r.identifiers(n.Parameters)
+		body := r.block(n.Body)
+		if changed || body != n.Body {
+			c := *n
+			c.Parameters, c.Body = params, body
+			return &c
+		}
+	case *CallExpression:
+		fn := r.expression(n.Function)
+		args, changed := r.expressions(n.Arguments)
+		if changed || fn != n.Function {
+			c := *n
+			c.Function, c.Arguments = fn, args
+			return &c
+		}
+	case *ArrayLiteral:
+		elems, changed := r.expressions(n.Elements)
+		if changed {
+			c := *n
+			c.Elements = elems
+			return &c
+		}
+	case *IndexExpression:
+		left, index := r.expression(n.Left), r.expression(n.Index)
+		if left != n.Left || index != n.Index {
+			c := *n
+			c.Left, c.Index = left, index
+			return &c
+		}
+	case *MemberExpression:
+		obj, prop := r.expression(n.Object), r.identifier(n.Property)
+		if obj != n.Object || prop != n.Property {
+			c := *n
+			c.Object, c.Property = obj, prop
+			return &c
+		}
+	case *HashLiteral:
+		pairs := make([]HashPair, len(n.Pairs))
+		changed := false
+		for i, pair := range n.Pairs {
+			pairs[i] = HashPair{Key: r.expression(pair.Key), Value: r.expression(pair.Value)}
+			changed = changed || pairs[i] != pair
+		}
+		if changed {
+			c := *n
+			c.Pairs = pairs
+			return &c
+		}
+	case *Identifier, *IntegerLiteral, *Boolean, *StringLiteral, *Comment:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+	return node
+}
+
+func (r *rewriter) statements(list []Statement) ([]Statement, bool) {
+	result := make([]Statement, 0, len(list))
+	changed := false
+	for _, stmt := range list {
+		node := r.rewrite(stmt)
+		if node == nil {
+			changed = true
+			continue
+		}
+		s, ok := node.(Statement)
+		if !ok {
+			panic(fmt.Sprintf("ast.Rewrite: %T is not a statement", node))
+		}
+		changed = changed || s != stmt
+		result = append(result, s)
+	}
+	return result, changed
+}
+
+func (r *rewriter) expression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+	node := r.rewrite(exp)
+	if node == nil {
+		return nil
+	}
+	e, ok := node.(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T is not an expression", node))
+	}
+	return e
+}
+
+func (r *rewriter) expressions(list []Expression) ([]Expression, bool) {
+	result := make([]Expression, len(list))
+	changed := false
+	for i, exp := range list {
+		result[i] = r.expression(exp)
+		changed = changed || result[i] != exp
+	}
+	return result, changed
+}
+
+func (r *rewriter) identifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	node := r.rewrite(ident)
+	if node == nil {
+		return nil
+	}
+	i, ok := node.(*Identifier)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T cannot replace an identifier", node))
+	}
+	return i
+}
+
+func (r *rewriter) identifiers(list []*Identifier) ([]*Identifier, bool) {
+	result := make([]*Identifier, len(list))
+	changed := false
+	for i, ident := range list {
+		result[i] = r.identifier(ident)
+		changed = changed || result[i] != ident
+	}
+	return result, changed
+}
+
+func (r *rewriter) block(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	node := r.rewrite(block)
+	if node == nil {
+		return nil
+	}
+	b, ok := node.(*BlockStatement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T cannot replace a block", node))
+	}
+	return b
+}
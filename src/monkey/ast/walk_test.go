@@ -0,0 +1,200 @@
+package ast_test
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestInspect(t *testing.T) {
+	program := parse(t, `let f = fn(x) { return -x; };
+if (true) { f(1)[0] } else { {"a": "b"}.keys() }`)
+
+	types := []string{}
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n != nil {
+			types = append(types, strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."))
+		}
+		return true
+	})
+
+	expected := []string{
+		"Program",
+		"LetStatement", "Identifier", "FunctionLiteral", "Identifier", "BlockStatement",
+		"ReturnStatement", "PrefixExpression", "Identifier",
+		"ExpressionStatement", "IfExpression", "Boolean",
+		"BlockStatement", "ExpressionStatement", "IndexExpression",
+		"CallExpression", "Identifier", "IntegerLiteral", "IntegerLiteral",
+		"BlockStatement", "ExpressionStatement", "CallExpression", "MemberExpression",
+		"HashLiteral", "StringLiteral", "StringLiteral", "Identifier",
+	}
+	if strings.Join(types, " ") != strings.Join(expected, " ") {
+		t.Errorf("visiting order wrong.\nwant=%v\ngot= %v", expected, types)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := parse(t, "let f = fn(a, b) { a + b }; f(1, 2)")
+
+	idents := []string{}
+	ast.Inspect(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		_, isFunction := n.(*ast.FunctionLiteral)
+		return !isFunction
+	})
+
+	if fmt.Sprint(idents) != "[f f]" {
+		t.Errorf("identifiers wrong. want=[f f], got=%v", idents)
+	}
+}
+
+// depthVisitor records the depth of every node, checking that Walk closes
+// each node it descends into with Visit(nil).
+type depthVisitor struct {
+	depth  *int
+	depths *[]int
+}
+
+func (v depthVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*v.depth--
+		return nil
+	}
+	*v.depths = append(*v.depths, *v.depth)
+	*v.depth++
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	program := parse(t, "1 + 2 * 3")
+
+	depth, depths := 0, []int{}
+	ast.Walk(depthVisitor{&depth, &depths}, program)
+
+	// Program, ExpressionStatement, 1 + (2 * 3), 1, 2 * 3, 2, 3
+	if fmt.Sprint(depths) != "[0 1 2 3 3 4 4]" {
+		t.Errorf("depths wrong. got=%v", depths)
+	}
+	if depth != 0 {
+		t.Errorf("Visit(nil) not called once per node. depth=%d", depth)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	program := parse(t, "let x = 1 + 2 * 3; puts(x); let f = fn(x) { x * (4 - 1) };")
+	before := program.String()
+
+	// fold integer arithmetic bottom up
+	fold := func(n ast.Node) ast.Node {
+		infix, ok := n.(*ast.InfixExpression)
+		if !ok {
+			return n
+		}
+		left, ok1 := infix.Left.(*ast.IntegerLiteral)
+		right, ok2 := infix.Right.(*ast.IntegerLiteral)
+		if !ok1 || !ok2 {
+			return n
+		}
+		var value int64
+		switch infix.Operator {
+		case "+":
+			value = left.Value + right.Value
+		case "-":
+			value = left.Value - right.Value
+		case "*":
+			value = left.Value * right.Value
+		default:
+			return n
+		}
+		return &ast.IntegerLiteral{Token: left.Token, Value: value}
+	}
+	// drop calls to puts
+	dropPuts := func(n ast.Node) ast.Node {
+		if stmt, ok := n.(*ast.ExpressionStatement); ok {
+			if call, ok := stmt.Expression.(*ast.CallExpression); ok && call.Function.String() == "puts" {
+				return nil
+			}
+		}
+		return n
+	}
+
+	result := ast.Rewrite(program, nil, func(n ast.Node) ast.Node {
+		n = fold(n)
+		if n == nil {
+			return nil
+		}
+		return dropPuts(n)
+	})
+
+	got := result.(*ast.Program)
+	if len(got.Statements) != 2 {
+		t.Fatalf("statements wrong. want=2, got=%d", len(got.Statements))
+	}
+	values := []int64{
+		got.Statements[0].(*ast.LetStatement).Value.(*ast.IntegerLiteral).Value,
+	}
+	fn := got.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	values = append(values, body.Right.(*ast.IntegerLiteral).Value)
+	if fmt.Sprint(values) != "[7 3]" {
+		t.Errorf("folded values wrong. want=[7 3], got=%v", values)
+	}
+	if fn.Name != "f" {
+		t.Errorf("copied function lost its name. got=%q", fn.Name)
+	}
+
+	if program.String() != before {
+		t.Errorf("Rewrite modified its input. got=%q", program.String())
+	}
+}
+
+func TestRewritePreOrder(t *testing.T) {
+	program := parse(t, "let a = b; let g = fn(b) { b };")
+
+	// rename b to c, but not inside functions, where b may be a parameter
+	result := ast.Rewrite(program, func(n ast.Node) (ast.Node, bool) {
+		if ident, ok := n.(*ast.Identifier); ok && ident.Value == "b" {
+			return &ast.Identifier{Token: ident.Token, Value: "c"}, false
+		}
+		_, isFunction := n.(*ast.FunctionLiteral)
+		return n, !isFunction
+	}, nil)
+
+	if result.String() != "let a = c;let g = fn<g>(b) b;" {
+		t.Errorf("rewritten program wrong. got=%q", result.String())
+	}
+	unchanged := program.Statements[1]
+	if result.(*ast.Program).Statements[1] != unchanged {
+		t.Errorf("unchanged statement was copied")
+	}
+}
+
+func TestRewritePanicsOnMisfit(t *testing.T) {
+	program := parse(t, "let a = 1;")
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected a panic")
+		}
+	}()
+	ast.Rewrite(program, nil, func(n ast.Node) ast.Node {
+		if _, ok := n.(*ast.IntegerLiteral); ok {
+			return &ast.ReturnStatement{}
+		}
+		return n
+	})
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"monkey/compiler"
+	"monkey"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
@@ -34,29 +35,29 @@ func main() {
 	var duration time.Duration
 	var result object.Object
 
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
-
 	if *engin == "vm" {
-		comp := compiler.New()
-		err := comp.Compile(program)
+		runtime := monkey.New()
+		program, err := runtime.Compile(input)
 		if err != nil {
 			fmt.Printf("compiler error: %s", err)
 			return
 		}
-		machine := vm.New(comp.Bytecode())
 		start := time.Now()
 
-		err = machine.Run()
+		result, err = runtime.Run(context.Background(), program)
 		if err != nil {
 			fmt.Printf("compiler error: %s", err)
+			if rerr, ok := err.(*vm.RuntimeError); ok {
+				fmt.Printf("\n%s", rerr.StackTrace())
+			}
 			return
 		}
 
 		duration = time.Since(start)
-		result = machine.LastPoppedStackElm()
 	} else {
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
 		env := object.NewEnvironment()
 		start := time.Now()
 		result = evaluator.Eval(program, env)
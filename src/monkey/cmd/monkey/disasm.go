@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"monkey"
+	"monkey/compiler"
+)
+
+func disasmCommand(ctx context.Context, args []string) int {
+	if len(args) != 1 {
+		return usageError("disasm: want exactly one file")
+	}
+	path := args[0]
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fail("%s", err)
+	}
+
+	var listing interface{ Disassemble(w io.Writer) error }
+	if filepath.Ext(path) == ".mbc" {
+		bytecode := &compiler.Bytecode{}
+		err = bytecode.UnmarshalBinary(data)
+		listing = bytecode
+	} else {
+		listing, err = compileSource(string(data))
+	}
+	if err != nil {
+		return report(path, &compileError{err})
+	}
+	err = listing.Disassemble(os.Stdout)
+	if err != nil {
+		return fail("%s", err)
+	}
+	return exitOK
+}
+
+// compileSource compiles src the way run does, so the script sees the
+// same globals, like args.
+func compileSource(src string) (*monkey.Program, error) {
+	r, err := newRuntime(nil)
+	if err != nil {
+		return nil, err
+	}
+	return r.Compile(src)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+
+	"monkey/format"
+)
+
+// fmtCommand formats scripts in the canonical style of package format. It
+// prints the formatted source, or with -w writes it back to the files
+// that change.
+func fmtCommand(ctx context.Context, args []string) int {
+	fs := newFlagSet("fmt")
+	write := fs.Bool("w", false, "")
+	err := fs.Parse(args)
+	if err != nil {
+		return usageError("fmt: %s", err)
+	}
+	if fs.NArg() == 0 {
+		return usageError("fmt: no file given")
+	}
+
+	code := exitOK
+	for _, path := range fs.Args() {
+		if c := formatFile(path, *write); code == exitOK {
+			code = c
+		}
+	}
+	return code
+}
+
+func formatFile(path string, write bool) int {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fail("%s", err)
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fail("%s", err)
+	}
+	out, err := format.Source(src)
+	if err != nil {
+		return report(path, &compileError{err})
+	}
+
+	if !write {
+		os.Stdout.Write(out)
+		return exitOK
+	}
+	if bytes.Equal(src, out) {
+		return exitOK
+	}
+	err = ioutil.WriteFile(path, out, info.Mode().Perm())
+	if err != nil {
+		return fail("%s", err)
+	}
+	return exitOK
+}
@@ -0,0 +1,122 @@
+// Command monkey runs, compiles and inspects Monkey programs.
+//
+// Usage:
+//
+//	monkey [command] [flags] [arguments]
+//
+// Without a command it starts the REPL; with a file instead of a command
+// it runs the file, so scripts starting with "#!/usr/bin/env monkey" can
+// be executed directly.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"monkey/repl"
+)
+
+// Exit codes.
+const (
+	exitOK      = 0
+	exitFailure = 1 // the script failed at runtime, or a test failed
+	exitUsage   = 2 // bad command line
+	exitCompile = 3 // the script does not parse or compile
+)
+
+const usage = `usage: monkey [command] [flags] [arguments]
+
+Commands:
+  run [--engine=vm|eval] FILE [ARGS...]   run a script
+  repl                                    start the REPL (the default)
+  compile [-o OUT.mbc] FILE               compile a script to bytecode
+  exec FILE.mbc [ARGS...]                 run compiled bytecode
+  disasm FILE                             print the bytecode of a script or .mbc file
+  fmt [-w] FILE...                        format scripts
+  test [--engine=vm|eval] [PATH...]       run *_test.monkey files
+
+"monkey FILE [ARGS...]" is short for "monkey run FILE [ARGS...]", or for
+"monkey exec" when FILE ends in .mbc. Scripts see ARGS as the array args.
+
+Exit status is 1 when the script fails at runtime, 2 on usage errors and
+3 when the script does not parse or compile.
+`
+
+var commands = map[string]func(ctx context.Context, args []string) int{
+	"run":     runCommand,
+	"repl":    replCommand,
+	"compile": compileCommand,
+	"exec":    execCommand,
+	"disasm":  disasmCommand,
+	"fmt":     fmtCommand,
+	"test":    testCommand,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := dispatch(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+func dispatch(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		return replCommand(ctx, args)
+	}
+	name := args[0]
+	if cmd, ok := commands[name]; ok {
+		return cmd(ctx, args[1:])
+	}
+	switch {
+	case name == "help" || name == "-h" || name == "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return exitOK
+	case strings.HasPrefix(name, "-"):
+		return usageError("unknown flag %s", name)
+	case filepath.Ext(name) == ".mbc":
+		return execCommand(ctx, args)
+	default:
+		return runCommand(ctx, args)
+	}
+}
+
+func replCommand(ctx context.Context, args []string) int {
+	if len(args) != 0 {
+		return usageError("repl takes no arguments")
+	}
+	user, err := user.Current()
+	if err != nil {
+		return fail("%s", err)
+	}
+	fmt.Printf("Hello %s! This is the Monkey programming language!\n",
+		user.Username)
+	fmt.Printf("Feel free to type in commands\n")
+	repl.Start(ctx, os.Stdin, os.Stdout)
+	return exitOK
+}
+
+// newFlagSet returns a flag set for the command name whose errors are
+// reported like every other usage error.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func usageError(format string, a ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "monkey: "+format+"\n", a...)
+	fmt.Fprint(os.Stderr, usage)
+	return exitUsage
+}
+
+func fail(format string, a ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "monkey: "+format+"\n", a...)
+	return exitFailure
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDispatchExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	ok := write("ok.monkey", "#!/usr/bin/env monkey\nlet n = len(args); if (n != 2) { 1 + true };")
+	failing := write("fail.monkey", "let f = fn() { 1 + true }; f();")
+	syntax := write("syntax.monkey", "let = 1;")
+	builtinErr := write("builtin.monkey", `let x = len(1); puts("still running")`)
+	passing := write("pass_test.monkey", `assert("ab".len() == 2, "len")`)
+	write("other.monkey", "assert(false)")
+	mbc := filepath.Join(dir, "ok.mbc")
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = devNull, devNull
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{ok, "a", "b"}, exitOK},
+		{[]string{"run", "--engine=eval", ok, "a", "b"}, exitOK},
+		{[]string{"run", ok}, exitFailure},
+		{[]string{failing}, exitFailure},
+		{[]string{"run", "--engine=eval", failing}, exitFailure},
+		{[]string{syntax}, exitCompile},
+		{[]string{builtinErr}, exitFailure},
+		{[]string{"run", "--engine=eval", builtinErr}, exitFailure},
+		{[]string{"compile", "-o", mbc, ok}, exitOK},
+		{[]string{"exec", mbc, "a", "b"}, exitOK},
+		{[]string{mbc, "a"}, exitFailure},
+		{[]string{"exec", ok}, exitCompile},
+		{[]string{"disasm", mbc}, exitOK},
+		{[]string{"disasm", ok}, exitOK},
+		{[]string{"disasm", syntax}, exitCompile},
+		{[]string{"test", dir}, exitOK},
+		{[]string{"test", "--engine=eval", passing}, exitOK},
+		{[]string{"test", filepath.Join(dir, "other.monkey")}, exitFailure},
+		{[]string{"fmt", ok}, exitOK},
+		{[]string{"fmt", "-w", ok, syntax}, exitCompile},
+		{[]string{"fmt"}, exitUsage},
+		{[]string{"run", "--engine=jit", ok}, exitUsage},
+		{[]string{"run"}, exitUsage},
+		{[]string{"--verbose"}, exitUsage},
+	}
+
+	for _, tt := range tests {
+		code := dispatch(context.Background(), tt.args)
+		if code != tt.expected {
+			t.Errorf("monkey %v exited with %d, want %d", tt.args, code, tt.expected)
+		}
+	}
+}
+
+func TestFmtWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messy.monkey")
+	err := ioutil.WriteFile(path, []byte("let x=1 // one\nputs( x )"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := dispatch(context.Background(), []string{"fmt", "-w", path}); code != exitOK {
+		t.Fatalf("monkey fmt -w exited with %d", code)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "let x = 1; // one\nputs(x);\n"
+	if string(got) != expected {
+		t.Errorf("formatted file wrong. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestRuntimeErrorReport(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "divide.monkey")
+	err := ioutil.WriteFile(path, []byte("let f = fn(x) {\n  10 / x\n};\nf(0);"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errFile, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer errFile.Close()
+	stderr := os.Stderr
+	os.Stderr = errFile
+	defer func() { os.Stderr = stderr }()
+
+	code := dispatch(context.Background(), []string{"run", path})
+	if code != exitFailure {
+		t.Errorf("monkey run exited with %d, want %d", code, exitFailure)
+	}
+	got, err := ioutil.ReadFile(errFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"runtime error: division by zero\n", "\tat f (2:"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("stderr does not contain %q. got=%q", want, got)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"monkey"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+)
+
+const (
+	engineVM   = "vm"
+	engineEval = "eval"
+)
+
+// compileError marks errors that happen before the script starts running.
+type compileError struct {
+	err error
+}
+
+func (e *compileError) Error() string { return e.err.Error() }
+
+func runCommand(ctx context.Context, args []string) int {
+	fs := newFlagSet("run")
+	engine := fs.String("engine", engineVM, "")
+	err := fs.Parse(args)
+	if err != nil {
+		return usageError("run: %s", err)
+	}
+	if *engine != engineVM && *engine != engineEval {
+		return usageError("run: unknown engine %q", *engine)
+	}
+	if fs.NArg() == 0 {
+		return usageError("run: no file given")
+	}
+
+	path := fs.Arg(0)
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fail("%s", err)
+	}
+	err = execute(ctx, *engine, string(src), fs.Args()[1:], nil)
+	if err != nil {
+		return report(path, err)
+	}
+	return exitOK
+}
+
+func compileCommand(ctx context.Context, args []string) int {
+	fs := newFlagSet("compile")
+	out := fs.String("o", "", "")
+	err := fs.Parse(args)
+	if err != nil {
+		return usageError("compile: %s", err)
+	}
+	if fs.NArg() != 1 {
+		return usageError("compile: want exactly one file")
+	}
+
+	path := fs.Arg(0)
+	if *out == "" {
+		*out = strings.TrimSuffix(path, filepath.Ext(path)) + ".mbc"
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fail("%s", err)
+	}
+	r, err := newRuntime(nil)
+	if err != nil {
+		return fail("%s", err)
+	}
+	program, err := r.Compile(string(src))
+	if err != nil {
+		return report(path, &compileError{err})
+	}
+	data, err := program.MarshalBinary()
+	if err != nil {
+		return fail("%s: %s", path, err)
+	}
+	err = ioutil.WriteFile(*out, data, 0644)
+	if err != nil {
+		return fail("%s", err)
+	}
+	return exitOK
+}
+
+func execCommand(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		return usageError("exec: no file given")
+	}
+
+	path := args[0]
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fail("%s", err)
+	}
+	r, err := newRuntime(args[1:])
+	if err != nil {
+		return fail("%s", err)
+	}
+	program, err := r.Load(data)
+	if err != nil {
+		return report(path, &compileError{err})
+	}
+	result, err := r.Run(ctx, program)
+	if err == nil {
+		err = errorResult(result)
+	}
+	if err != nil {
+		return report(path, err)
+	}
+	return exitOK
+}
+
+func testCommand(ctx context.Context, args []string) int {
+	fs := newFlagSet("test")
+	engine := fs.String("engine", engineVM, "")
+	err := fs.Parse(args)
+	if err != nil {
+		return usageError("test: %s", err)
+	}
+	if *engine != engineVM && *engine != engineEval {
+		return usageError("test: unknown engine %q", *engine)
+	}
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := testFiles(paths)
+	if err != nil {
+		return fail("%s", err)
+	}
+	if len(files) == 0 {
+		fmt.Println("no test files")
+		return exitOK
+	}
+
+	host := map[string]object.HostFunction{"assert": assert}
+	code := exitOK
+	for _, path := range files {
+		src, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = execute(ctx, *engine, string(src), nil, host)
+		}
+		if err != nil {
+			fmt.Printf("FAIL %s\n", path)
+			report(path, err)
+			code = exitFailure
+			continue
+		}
+		fmt.Printf("ok   %s\n", path)
+	}
+	return code
+}
+
+// testFiles returns the *_test.monkey files in paths, searching
+// directories recursively. Files named explicitly are always included.
+func testFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(p, "_test.monkey") {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// assert is the builtin test scripts check their expectations with:
+// assert(condition) or assert(condition, message).
+func assert(ctx context.Context, args ...object.Object) (object.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments to `assert`. got=%d, want=1 or 2", len(args))
+	}
+	if args[0] != object.FALSE && args[0] != object.NULL {
+		return object.NULL, nil
+	}
+	if len(args) == 2 {
+		return nil, fmt.Errorf("assertion failed: %s", args[1].Inspect())
+	}
+	return nil, errors.New("assertion failed")
+}
+
+// newRuntime returns a Runtime with the script arguments bound to the
+// global args. compile and exec both use it, so compiled programs and the
+// Runtime running them agree on the index of args.
+func newRuntime(args []string) (*monkey.Runtime, error) {
+	if args == nil {
+		args = []string{}
+	}
+	r := monkey.New()
+	err := r.SetGlobalValue("args", args)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// execute runs src on engine with args bound to the global args and the
+// host functions registered as builtins.
+func execute(ctx context.Context, engine, src string, args []string, host map[string]object.HostFunction) error {
+	if engine == engineEval {
+		return evaluate(ctx, src, args, host)
+	}
+
+	r, err := newRuntime(args)
+	if err != nil {
+		return err
+	}
+	for name, fn := range host {
+		err := r.Register(name, fn)
+		if err != nil {
+			return err
+		}
+	}
+	program, err := r.Compile(src)
+	if err != nil {
+		return &compileError{err}
+	}
+	result, err := r.Run(ctx, program)
+	if err != nil {
+		return err
+	}
+	return errorResult(result)
+}
+
+func evaluate(ctx context.Context, src string, args []string, host map[string]object.HostFunction) error {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return &compileError{&monkey.ParseError{Errors: p.Errors()}}
+	}
+
+	registry := object.NewRegistry()
+	for name, fn := range host {
+		err := registry.Register(name, fn)
+		if err != nil {
+			return err
+		}
+	}
+	if args == nil {
+		args = []string{}
+	}
+	argsObj, err := object.FromGo(args)
+	if err != nil {
+		return err
+	}
+	env := object.NewEnvironmentWithContext(ctx, 0)
+	env.SetBuiltins(registry)
+	env.Set("args", argsObj)
+
+	return errorResult(evaluator.Eval(program, env))
+}
+
+// errorResult turns a script that ends in an error value into an error.
+func errorResult(result object.Object) error {
+	if errObj, ok := result.(*object.Error); ok {
+		return errObj
+	}
+	return nil
+}
+
+// report prints err for the script at path and returns the exit code.
+func report(path string, err error) int {
+	var cerr *compileError
+	if errors.As(err, &cerr) {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, cerr.err)
+		return exitCompile
+	}
+	fmt.Fprintf(os.Stderr, "%s: runtime error: %s\n", path, err)
+	var rerr *vm.RuntimeError
+	if errors.As(err, &rerr) {
+		fmt.Fprint(os.Stderr, rerr.StackTrace())
+	}
+	return exitFailure
+}
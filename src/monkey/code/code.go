@@ -4,11 +4,17 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"sort"
 )
 
 type Instructions []byte
 type Opcode byte
 
+// Version identifies the opcode set. Bump it whenever an opcode is added,
+// removed or renumbered or its operand widths change, so serialized
+// bytecode from an older compiler is rejected instead of misread.
+const Version = 1
+
 const (
 	OpConstant Opcode = iota
 	OpAdd
@@ -40,6 +46,8 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpGetAttr
+	OpCallMethod
 )
 
 type Definition struct {
@@ -78,6 +86,8 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpGetAttr:        {"OpGetAttr", []int{2}},
+	OpCallMethod:     {"OpCallMethod", []int{2, 1}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -120,8 +130,13 @@ func (ins Instructions) String() string {
 		def, err := Lookup(ins[i])
 		if err != nil {
 			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
 			continue
 		}
+		if i+1+def.width() > len(ins) {
+			fmt.Fprintf(&out, "ERROR: %s: truncated operands\n", def.Name)
+			break
+		}
 		operands, read := ReadOperands(def, ins[i+1:])
 		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
 		i += 1 + read
@@ -165,3 +180,23 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 	}
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
 }
+
+// LineEntry records that the instructions starting at Offset were compiled
+// from the source at Line:Column.
+type LineEntry struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// LineTable maps instruction offsets to source positions. Entries are
+// sorted by Offset; an entry covers every instruction up to the next one.
+type LineTable []LineEntry
+
+func (lt LineTable) Lookup(offset int) (LineEntry, bool) {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset > offset })
+	if i == 0 {
+		return LineEntry{}, false
+	}
+	return lt[i-1], true
+}
@@ -15,6 +15,7 @@ func TestMake(t *testing.T) {
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
 		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpCallMethod, []int{65534, 2}, []byte{byte(OpCallMethod), 255, 254, 2}},
 	}
 
 	for _, tt := range tests {
@@ -86,3 +87,37 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestLineTableLookup(t *testing.T) {
+	lines := LineTable{
+		{Offset: 0, Line: 1, Column: 1},
+		{Offset: 3, Line: 1, Column: 5},
+		{Offset: 7, Line: 2, Column: 1},
+	}
+	tests := []struct {
+		offset       int
+		expectedLine int
+		expectedCol  int
+	}{
+		{0, 1, 1},
+		{2, 1, 1},
+		{3, 1, 5},
+		{6, 1, 5},
+		{7, 2, 1},
+		{100, 2, 1},
+	}
+	for _, tt := range tests {
+		entry, ok := lines.Lookup(tt.offset)
+		if !ok {
+			t.Fatalf("no entry for offset %d", tt.offset)
+		}
+		if entry.Line != tt.expectedLine || entry.Column != tt.expectedCol {
+			t.Errorf("wrong position for offset %d. want=%d:%d, got=%d:%d",
+				tt.offset, tt.expectedLine, tt.expectedCol, entry.Line, entry.Column)
+		}
+	}
+
+	if _, ok := (LineTable{}).Lookup(0); ok {
+		t.Errorf("empty table returned an entry")
+	}
+}
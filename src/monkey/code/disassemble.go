@@ -0,0 +1,168 @@
+package code
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Function is a compiled function as Disassemble sees it.
+type Function struct {
+	Name          string
+	NumParameters int
+	NumLocals     int
+	Instructions  Instructions
+	Lines         LineTable
+}
+
+// Program is what Disassemble prints. The code package cannot depend on
+// object, so callers describe the constant pool themselves; see
+// compiler.Bytecode.Disassemble.
+type Program struct {
+	Main Function
+	// Constants holds the display form of each constant, e.g. "hello" quoted.
+	Constants []string
+	// Functions maps constant indexes to the functions stored there.
+	Functions map[int]Function
+	// Builtins names the builtin each OpGetBuiltin operand refers to.
+	Builtins []string
+}
+
+// Disassemble writes a listing of the main program followed by every
+// function in the constant pool. Each function starts with a header giving
+// its arity, locals and free variables. Instructions are annotated with
+// their source position, the constants and builtins they refer to and
+// the labels they jump to. Malformed instructions are reported inline.
+func Disassemble(w io.Writer, p *Program) error {
+	numFree := closureFreeCounts(p)
+
+	var out bytes.Buffer
+	disassembleFunction(&out, p, "<main>", p.Main, 0)
+
+	indexes := make([]int, 0, len(p.Functions))
+	for i := range p.Functions {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		fn := p.Functions[i]
+		name := fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		out.WriteString("\n")
+		disassembleFunction(&out, p, fmt.Sprintf("%s (constant %d)", name, i), fn, numFree[i])
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// closureFreeCounts maps function constant indexes to the number of free
+// variables the OpClosure instructions creating them capture.
+func closureFreeCounts(p *Program) map[int]int {
+	counts := make(map[int]int)
+	collect := func(ins Instructions) {
+		forEachInstruction(ins, func(offset int, def *Definition, operands []int) {
+			if Opcode(ins[offset]) == OpClosure {
+				counts[operands[0]] = operands[1]
+			}
+		})
+	}
+	collect(p.Main.Instructions)
+	for _, fn := range p.Functions {
+		collect(fn.Instructions)
+	}
+	return counts
+}
+
+// forEachInstruction calls f for every well-formed instruction in ins,
+// stopping at the first malformed one.
+func forEachInstruction(ins Instructions, f func(offset int, def *Definition, operands []int)) {
+	for i := 0; i < len(ins); {
+		def, err := Lookup(ins[i])
+		if err != nil || i+1+def.width() > len(ins) {
+			return
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		f(i, def, operands)
+		i += 1 + read
+	}
+}
+
+func disassembleFunction(out *bytes.Buffer, p *Program, name string, fn Function, numFree int) {
+	fmt.Fprintf(out, "function %s: params %d, locals %d, free %d\n",
+		name, fn.NumParameters, fn.NumLocals, numFree)
+
+	ins := fn.Instructions
+	labels := make(map[int]bool)
+	forEachInstruction(ins, func(offset int, def *Definition, operands []int) {
+		op := Opcode(ins[offset])
+		if op == OpJump || op == OpJumpNotTruthy {
+			labels[operands[0]] = true
+		}
+	})
+
+	lastLine := LineEntry{Offset: -1}
+	for i := 0; i < len(ins); {
+		if labels[i] {
+			fmt.Fprintf(out, "L%04d:\n", i)
+		}
+
+		pos := ""
+		if entry, ok := fn.Lines.Lookup(i); ok && entry != lastLine {
+			pos = fmt.Sprintf("%d:%d", entry.Line, entry.Column)
+			lastLine = entry
+		}
+
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(out, "%8s  %04d  ERROR: %s\n", pos, i, err)
+			i++
+			continue
+		}
+		if i+1+def.width() > len(ins) {
+			fmt.Fprintf(out, "%8s  %04d  ERROR: %s: truncated operands\n", pos, i, def.Name)
+			break
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		text := ins.fmtInstruction(def, operands)
+		if comment := p.comment(Opcode(ins[i]), operands); comment != "" {
+			text = fmt.Sprintf("%-24s ; %s", text, comment)
+		}
+		fmt.Fprintf(out, "%8s  %04d  %s\n", pos, i, text)
+		i += 1 + read
+	}
+	if labels[len(ins)] {
+		fmt.Fprintf(out, "L%04d:\n", len(ins))
+	}
+}
+
+// comment explains the operands of an instruction.
+func (p *Program) comment(op Opcode, operands []int) string {
+	switch op {
+	case OpConstant, OpClosure, OpGetAttr, OpCallMethod:
+		if operands[0] < len(p.Constants) {
+			return p.Constants[operands[0]]
+		}
+		return "ERROR: no such constant"
+	case OpGetBuiltin:
+		if operands[0] < len(p.Builtins) && p.Builtins[operands[0]] != "" {
+			return p.Builtins[operands[0]]
+		}
+		return "ERROR: no such builtin"
+	case OpJump, OpJumpNotTruthy:
+		return fmt.Sprintf("-> L%04d", operands[0])
+	}
+	return ""
+}
+
+// width is the number of operand bytes following the opcode.
+func (def *Definition) width() int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
+}
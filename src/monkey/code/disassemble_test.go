@@ -0,0 +1,78 @@
+package code
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	concat := func(ins ...[]byte) Instructions {
+		out := Instructions{}
+		for _, in := range ins {
+			out = append(out, in...)
+		}
+		return out
+	}
+	p := &Program{
+		Main: Function{
+			Instructions: concat(
+				Make(OpTrue),
+				Make(OpJumpNotTruthy, 8),
+				Make(OpConstant, 0),
+				Make(OpPop),
+				Make(OpClosure, 1, 0),
+				Make(OpGetBuiltin, 0),
+				Make(OpPop),
+				[]byte{255},
+			),
+			Lines: LineTable{{Offset: 0, Line: 1, Column: 1}, {Offset: 4, Line: 2, Column: 3}},
+		},
+		Constants: []string{`"hi"`, "fn f"},
+		Functions: map[int]Function{
+			1: {
+				Name:          "f",
+				NumParameters: 1,
+				NumLocals:     2,
+				Instructions:  concat(Make(OpGetFree, 0), Make(OpReturnValue)),
+			},
+		},
+		Builtins: []string{"len"},
+	}
+
+	expected := `function <main>: params 0, locals 0, free 0
+     1:1  0000  OpTrue
+          0001  OpJumpNotTruthy 8        ; -> L0008
+     2:3  0004  OpConstant 0             ; "hi"
+          0007  OpPop
+L0008:
+          0008  OpClosure 1 0            ; fn f
+          0012  OpGetBuiltin 0           ; len
+          0014  OpPop
+          0015  ERROR: opcode 255 undefined
+
+function f (constant 1): params 1, locals 2, free 0
+          0000  OpGetFree 0
+          0002  OpReturnValue
+`
+
+	var out bytes.Buffer
+	err := Disassemble(&out, p)
+	if err != nil {
+		t.Fatalf("Disassemble failed: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestInstructionsStringMalformed(t *testing.T) {
+	ins := Instructions{byte(OpPop), 255, byte(OpConstant), 1}
+
+	expected := `0000 OpPop
+ERROR: opcode 255 undefined
+ERROR: OpConstant: truncated operands
+`
+	if ins.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, ins.String())
+	}
+}
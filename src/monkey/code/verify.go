@@ -0,0 +1,136 @@
+package code
+
+import "fmt"
+
+// VerifyError describes the first problem Verify found in an instruction
+// stream.
+type VerifyError struct {
+	Offset  int
+	Message string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("offset %d: %s", e.Offset, e.Message)
+}
+
+// Verify checks that ins is well formed: every opcode is defined, no
+// instruction is cut off, jumps land on instruction boundaries (or the
+// end of ins), OpHash takes whole pairs and the stack never underflows.
+// Every path reaching an instruction must reach it with the same stack
+// depth.
+//
+// Verify knows nothing about constants, globals or locals, nor whether ins
+// is a function that may return; vm.Verify checks those against a whole
+// Bytecode.
+func Verify(ins Instructions) error {
+	// boundary[i] is true when an instruction starts at i.
+	boundary := make([]bool, len(ins)+1)
+	boundary[len(ins)] = true
+	for i := 0; i < len(ins); {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			return &VerifyError{Offset: i, Message: fmt.Sprintf("unknown opcode %d", ins[i])}
+		}
+		if i+1+def.width() > len(ins) {
+			return &VerifyError{Offset: i, Message: fmt.Sprintf("%s: truncated operands", def.Name)}
+		}
+		boundary[i] = true
+		i += 1 + def.width()
+	}
+
+	for i := 0; i < len(ins); {
+		op := Opcode(ins[i])
+		def := definitions[op]
+		operands, read := ReadOperands(def, ins[i+1:])
+		if op == OpJump || op == OpJumpNotTruthy {
+			target := operands[0]
+			if target > len(ins) || !boundary[target] {
+				return &VerifyError{Offset: i, Message: fmt.Sprintf("%s: jump target %d is not an instruction boundary", def.Name, target)}
+			}
+		}
+		if op == OpHash && operands[0]%2 != 0 {
+			return &VerifyError{Offset: i, Message: fmt.Sprintf("%s: odd number of keys and values %d", def.Name, operands[0])}
+		}
+		i += 1 + read
+	}
+
+	return verifyStack(ins)
+}
+
+// verifyStack follows every path through ins, tracking the stack depth.
+func verifyStack(ins Instructions) error {
+	depths := make([]int, len(ins)+1)
+	for i := range depths {
+		depths[i] = -1
+	}
+
+	type path struct{ offset, depth int }
+	pending := []path{{0, 0}}
+	for len(pending) > 0 {
+		p := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		i, depth := p.offset, p.depth
+	walk:
+		for {
+			if depths[i] != -1 {
+				if depths[i] != depth {
+					return &VerifyError{Offset: i, Message: fmt.Sprintf("stack depth %d here, %d on another path", depth, depths[i])}
+				}
+				break
+			}
+			depths[i] = depth
+			if i == len(ins) {
+				break
+			}
+
+			op := Opcode(ins[i])
+			def := definitions[op]
+			operands, read := ReadOperands(def, ins[i+1:])
+			pop, push := stackEffect(op, operands)
+			if depth < pop {
+				return &VerifyError{Offset: i, Message: fmt.Sprintf("%s: stack underflow, needs %d values, has %d", def.Name, pop, depth)}
+			}
+			depth += push - pop
+
+			switch op {
+			case OpJump:
+				i = operands[0]
+				continue
+			case OpJumpNotTruthy:
+				pending = append(pending, path{operands[0], depth})
+			case OpReturnValue, OpReturn:
+				break walk
+			}
+			i += 1 + read
+		}
+	}
+	return nil
+}
+
+// stackEffect reports how many values op pops off the stack and how many
+// it pushes.
+func stackEffect(op Opcode, operands []int) (pop, push int) {
+	switch op {
+	case OpConstant, OpTrue, OpFalse, OpNull, OpGetGlobal, OpGetLocal,
+		OpGetBuiltin, OpGetFree, OpCurrentClosure:
+		return 0, 1
+	case OpAdd, OpSub, OpMul, OpDiv, OpEqual, OpNotEqual, OpGreaterThan, OpIndex:
+		return 2, 1
+	case OpMinus, OpBang, OpGetAttr:
+		return 1, 1
+	case OpPop, OpSetGlobal, OpSetLocal, OpJumpNotTruthy, OpReturnValue:
+		return 1, 0
+	case OpArray, OpHash:
+		return operands[0], 1
+	case OpCall:
+		return operands[0] + 1, 1
+	case OpCallMethod:
+		return operands[1] + 1, 1
+	case OpClosure:
+		return operands[1], 1
+	default:
+		// OpJump, OpReturn
+		return 0, 0
+	}
+}
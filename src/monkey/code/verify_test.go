@@ -0,0 +1,86 @@
+package code
+
+import "testing"
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Instructions
+		expected string
+	}{
+		{
+			name: "valid conditional",
+			input: []Instructions{
+				Make(OpTrue),
+				Make(OpJumpNotTruthy, 10),
+				Make(OpConstant, 0),
+				Make(OpJump, 11),
+				Make(OpNull),
+				Make(OpPop),
+			},
+		},
+		{
+			name:     "unknown opcode",
+			input:    []Instructions{Make(OpNull), {255}},
+			expected: "offset 1: unknown opcode 255",
+		},
+		{
+			name:     "truncated operands",
+			input:    []Instructions{Make(OpNull), Make(OpConstant, 1)[:2]},
+			expected: "offset 1: OpConstant: truncated operands",
+		},
+		{
+			name:     "jump into an instruction",
+			input:    []Instructions{Make(OpJump, 4), Make(OpConstant, 0)},
+			expected: "offset 0: OpJump: jump target 4 is not an instruction boundary",
+		},
+		{
+			name:     "jump past the end",
+			input:    []Instructions{Make(OpJump, 10)},
+			expected: "offset 0: OpJump: jump target 10 is not an instruction boundary",
+		},
+		{
+			name:     "stack underflow",
+			input:    []Instructions{Make(OpConstant, 0), Make(OpAdd)},
+			expected: "offset 3: OpAdd: stack underflow, needs 2 values, has 1",
+		},
+		{
+			name: "unbalanced branches",
+			input: []Instructions{
+				Make(OpTrue),
+				Make(OpJumpNotTruthy, 7),
+				Make(OpNull),
+				Make(OpNull),
+				Make(OpPop),
+			},
+			expected: "offset 7: stack depth 0 here, 1 on another path",
+		},
+		{
+			name:     "hash with a key but no value",
+			input:    []Instructions{Make(OpNull), Make(OpNull), Make(OpNull), Make(OpHash, 3), Make(OpPop)},
+			expected: "offset 3: OpHash: odd number of keys and values 3",
+		},
+		{
+			name:     "call needs its arguments",
+			input:    []Instructions{Make(OpGetBuiltin, 0), Make(OpCall, 2)},
+			expected: "offset 2: OpCall: stack underflow, needs 3 values, has 1",
+		},
+	}
+
+	for _, tt := range tests {
+		ins := Instructions{}
+		for _, in := range tt.input {
+			ins = append(ins, in...)
+		}
+		err := Verify(ins)
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
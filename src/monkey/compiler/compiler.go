@@ -5,7 +5,8 @@ import (
 	"monkey/ast"
 	"monkey/code"
 	"monkey/object"
-	"sort"
+	"monkey/token"
+	"strings"
 )
 
 type EmittedInstruction struct {
@@ -17,6 +18,7 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	lines               code.LineTable
 }
 
 type Compiler struct {
@@ -25,17 +27,24 @@ type Compiler struct {
 	symbolTable  *SymbolTable
 	scopes       []CompilationScope
 	scopeIndex   int
+	// position of the node being compiled, recorded in the line table on emit.
+	position token.Position
 }
 
 func New() *Compiler {
+	return NewWithBuiltins(object.NewRegistry())
+}
+
+// NewWithBuiltins creates a compiler that resolves builtins from r.
+func NewWithBuiltins(r *object.Registry) *Compiler {
 	mainScope := CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
 	}
 	symbolTable := NewSymbolTable()
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
+	for i, name := range r.Names() {
+		symbolTable.DefineBuiltin(i, name)
 	}
 	return &Compiler{
 		instructions: code.Instructions{},
@@ -54,6 +63,12 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	if pos := node.Pos(); pos.IsValid() {
+		outer := c.position
+		c.position = pos
+		defer func() { c.position = outer }()
+	}
+
 	switch node := node.(type) {
 	case *ast.ArrayLiteral:
 		for _, e := range node.Elements {
@@ -72,9 +87,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.CallExpression:
+		if member, ok := node.Function.(*ast.MemberExpression); ok {
+			if _, ok := c.resolveQualified(member); !ok {
+				return c.compileMethodCall(member, node.Arguments)
+			}
+		}
 		err := c.Compile(node.Function)
 		if err != nil {
-			return nil
+			return err
 		}
 		for _, a := range node.Arguments {
 			err := c.Compile(a)
@@ -124,11 +144,21 @@ func (c *Compiler) Compile(node ast.Node) error {
 		freeSymbols := c.symbolTable.FreeSymbols
 		// set numLocals before leve scope.
 		numLocals := c.symbolTable.numDefinitions
+		lines := c.scopes[c.scopeIndex].lines
 		instructions := c.leaveScope()
 		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+			err := c.loadSymbol(s)
+			if err != nil {
+				return err
+			}
+		}
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			Lines:         lines,
 		}
-		compiledFn := &object.CompiledFunction{Instructions: instructions, NumLocals: numLocals, NumParameters: len(node.Parameters)}
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
 	case *ast.PrefixExpression:
@@ -149,27 +179,30 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if !ok {
 			return fmt.Errorf("undefined variable %s", node.Value)
 		}
-		c.loadSymbol(symbol)
+		return c.loadSymbol(symbol)
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-
-		for _, k := range keys {
-			err := c.Compile(k)
+		// keys and values are evaluated in source order
+		for _, pair := range node.Pairs {
+			err := c.Compile(pair.Key)
 			if err != nil {
 				return err
 			}
-			err = c.Compile(node.Pairs[k])
+			err = c.Compile(pair.Value)
 			if err != nil {
 				return err
 			}
 		}
 		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.MemberExpression:
+		if symbol, ok := c.resolveQualified(node); ok {
+			return c.loadSymbol(symbol)
+		}
+		err := c.Compile(node.Object)
+		if err != nil {
+			return err
+		}
+		name := c.addConstant(&object.String{Value: node.Property.Value})
+		c.emit(code.OpGetAttr, name)
 	case *ast.IndexExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -291,12 +324,19 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constans:     c.constants,
+		Lines:        c.scopes[c.scopeIndex].lines,
+		Builtins:     c.symbolTable.BuiltinNames(),
 	}
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constans     []object.Object
+	// Lines maps offsets in Instructions to source positions.
+	Lines code.LineTable
+	// Builtins names the builtin each OpGetBuiltin operand refers to, so
+	// the VM can look them up by name in its own registry.
+	Builtins []string
 }
 
 func (c *Compiler) addConstant(obj object.Object) int {
@@ -330,9 +370,22 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	pos := c.addInstrucion(ins)
 	// pos is index of new instruction
 	c.setLastInstruction(op, pos)
+	c.addLine(pos)
 	return pos
 }
 
+func (c *Compiler) addLine(pos int) {
+	if !c.position.IsValid() {
+		return
+	}
+	lines := c.scopes[c.scopeIndex].lines
+	if n := len(lines); n > 0 && lines[n-1].Line == c.position.Line && lines[n-1].Column == c.position.Column {
+		return
+	}
+	entry := code.LineEntry{Offset: pos, Line: c.position.Line, Column: c.position.Column}
+	c.scopes[c.scopeIndex].lines = append(lines, entry)
+}
+
 func (c *Compiler) enterScope() {
 	scope := CompilationScope{
 		instructions:        code.Instructions{},
@@ -359,19 +412,28 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 }
 
-func (c *Compiler) loadSymbol(s Symbol) {
+// maxBuiltins is the number of builtins the one byte operand of
+// OpGetBuiltin can refer to.
+const maxBuiltins = 256
+
+func (c *Compiler) loadSymbol(s Symbol) error {
 	switch s.Scope {
 	case GlobalScope:
 		c.emit(code.OpGetGlobal, s.Index)
 	case LocalScope:
 		c.emit(code.OpGetLocal, s.Index)
 	case BuiltinScope:
+		if s.Index >= maxBuiltins {
+			return fmt.Errorf("builtin %s has index %d, but OpGetBuiltin can only refer to %d builtins",
+				s.Name, s.Index, maxBuiltins)
+		}
 		c.emit(code.OpGetBuiltin, s.Index)
 	case FreeScope:
 		c.emit(code.OpGetFree, s.Index)
 	case FunctionScope:
 		c.emit(code.OpCurrentClosure)
 	}
+	return nil
 }
 
 func (c *Compiler) removeLastPop() {
@@ -383,6 +445,13 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	// drop line entries pointing at the removed instruction.
+	lines := c.scopes[c.scopeIndex].lines
+	for len(lines) > 0 && lines[len(lines)-1].Offset >= last.Position {
+		lines = lines[:len(lines)-1]
+	}
+	c.scopes[c.scopeIndex].lines = lines
 }
 
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
@@ -404,3 +473,36 @@ func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
 	c.scopes[c.scopeIndex].previousInstruction = previous
 	c.scopes[c.scopeIndex].lastInstruction = last
 }
+
+// resolveQualified resolves node to a builtin unless a variable shadows it.
+func (c *Compiler) resolveQualified(node *ast.MemberExpression) (Symbol, bool) {
+	name, ok := node.QualifiedName()
+	if !ok {
+		return Symbol{}, false
+	}
+	root := name[:strings.Index(name, ".")]
+	if _, ok := c.symbolTable.Resolve(root); ok {
+		return Symbol{}, false
+	}
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != BuiltinScope {
+		return Symbol{}, false
+	}
+	return symbol, true
+}
+
+func (c *Compiler) compileMethodCall(node *ast.MemberExpression, args []ast.Expression) error {
+	err := c.Compile(node.Object)
+	if err != nil {
+		return err
+	}
+	for _, a := range args {
+		err := c.Compile(a)
+		if err != nil {
+			return err
+		}
+	}
+	name := c.addConstant(&object.String{Value: node.Property.Value})
+	c.emit(code.OpCallMethod, name, len(args))
+	return nil
+}
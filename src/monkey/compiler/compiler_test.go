@@ -419,6 +419,25 @@ func TestFunctionCalls(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestUndefinedVariables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x", "undefined variable x"},
+		{"f(1)", "undefined variable f"},
+		{"len(x)", "undefined variable x"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error compiling %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
 func TestFunctionsWithoutReturnValue(t *testing.T) {
 	tests := []compilerTestCase{{
 		input: `fn() { }`,
@@ -468,6 +487,100 @@ func TestIndexExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestMemberExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let req = 1; req.path",
+			expectedConstants: []interface{}{1, "path"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetAttr, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let req = 1; req.header("x")`,
+			expectedConstants: []interface{}{1, "x", "header"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCallMethod, 2, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestNamespacedBuiltins(t *testing.T) {
+	registry := object.NewRegistry()
+	registry.Register("http.get", nil)
+	index := len(object.Builtins)
+
+	tests := []struct {
+		input    string
+		expected []code.Instructions
+	}{
+		{
+			input: `http.get("x")`,
+			expected: []code.Instructions{
+				code.Make(code.OpGetBuiltin, index),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a variable named like the namespace shadows it
+			input: `let http = 1; http.get`,
+			expected: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetAttr, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := NewWithBuiltins(registry)
+		err := compiler.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err = testInstructions(tt.expected, compiler.Bytecode().Instructions)
+		if err != nil {
+			t.Fatalf("testInstructions failed: %s", err)
+		}
+	}
+}
+
+func TestTooManyBuiltins(t *testing.T) {
+	registry := object.NewRegistry()
+	for i := len(registry.Names()); i <= maxBuiltins; i++ {
+		registry.Register(fmt.Sprintf("host.%c%c", 'a'+i/26, 'a'+i%26), nil)
+	}
+	last := registry.Names()[maxBuiltins]
+
+	compiler := NewWithBuiltins(registry)
+	err := compiler.Compile(parse("len"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := fmt.Sprintf("builtin %s has index 256, but OpGetBuiltin can only refer to 256 builtins", last)
+	compiler = NewWithBuiltins(registry)
+	err = compiler.Compile(parse(last))
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
+
 func TestIntegerArithmetic(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -803,6 +916,18 @@ func TestHashLiterals(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "{3: 4, 1: 2}",
+			expectedConstants: []interface{}{3, 4, 1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
 		{
 			input:             "{1: 2 + 3, 4: 5 * 6}",
 			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
@@ -979,3 +1104,54 @@ func testStringObject(expected string, actual object.Object) error {
 	}
 	return nil
 }
+
+func TestLineTables(t *testing.T) {
+	input := `let one = fn() {
+  1 + 2
+};
+one();`
+
+	program := parse(input)
+	compiler := New()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	expectedMain := code.LineTable{
+		{Offset: 0, Line: 1, Column: 11},
+		{Offset: 4, Line: 1, Column: 1},
+		{Offset: 7, Line: 4, Column: 1},
+		{Offset: 10, Line: 4, Column: 4},
+		{Offset: 12, Line: 4, Column: 1},
+	}
+	testLineTable(t, expectedMain, bytecode.Lines)
+
+	fn, ok := bytecode.Constans[2].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 2 - not a function: %T", bytecode.Constans[2])
+	}
+	if fn.Name != "one" {
+		t.Errorf("wrong function name. want=%q, got=%q", "one", fn.Name)
+	}
+	expectedFn := code.LineTable{
+		{Offset: 0, Line: 2, Column: 3},
+		{Offset: 3, Line: 2, Column: 7},
+		{Offset: 6, Line: 2, Column: 5},
+		{Offset: 7, Line: 2, Column: 3},
+	}
+	testLineTable(t, expectedFn, fn.Lines)
+}
+
+func testLineTable(t *testing.T, expected, actual code.LineTable) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("wrong line table length. want=%+v\ngot=%+v", expected, actual)
+	}
+	for i, entry := range expected {
+		if actual[i] != entry {
+			t.Errorf("wrong line entry at %d. want=%+v, got=%+v", i, entry, actual[i])
+		}
+	}
+}
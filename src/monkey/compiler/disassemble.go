@@ -0,0 +1,44 @@
+package compiler
+
+import (
+	"io"
+	"monkey/code"
+	"monkey/object"
+	"strconv"
+)
+
+// Disassemble writes a listing of b; see code.Disassemble.
+func (b *Bytecode) Disassemble(w io.Writer) error {
+	p := &code.Program{
+		Main: code.Function{
+			Name:         "<main>",
+			Instructions: b.Instructions,
+			Lines:        b.Lines,
+		},
+		Constants: make([]string, len(b.Constans)),
+		Functions: make(map[int]code.Function),
+		Builtins:  b.Builtins,
+	}
+	for i, constant := range b.Constans {
+		switch constant := constant.(type) {
+		case *object.String:
+			p.Constants[i] = strconv.Quote(constant.Value)
+		case *object.CompiledFunction:
+			name := constant.Name
+			if name == "" {
+				name = "<anonymous>"
+			}
+			p.Constants[i] = "fn " + name
+			p.Functions[i] = code.Function{
+				Name:          constant.Name,
+				NumParameters: constant.NumParameters,
+				NumLocals:     constant.NumLocals,
+				Instructions:  constant.Instructions,
+				Lines:         constant.Lines,
+			}
+		default:
+			p.Constants[i] = constant.Inspect()
+		}
+	}
+	return code.Disassemble(w, p)
+}
@@ -0,0 +1,33 @@
+package compiler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBytecodeDisassemble(t *testing.T) {
+	comp := New()
+	err := comp.Compile(parse(`let add = fn(a, b) { a + b }; add(1, len("x"))`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	err = comp.Bytecode().Disassemble(&out)
+	if err != nil {
+		t.Fatalf("Disassemble failed: %s", err)
+	}
+
+	for _, want := range []string{
+		"function <main>: params 0, locals 0, free 0\n",
+		"OpClosure 0 0            ; fn add\n",
+		"OpGetBuiltin 0           ; len\n",
+		"OpConstant 2             ; \"x\"\n",
+		"function add (constant 0): params 2, locals 2, free 0\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("listing does not contain %q. got=\n%s", want, out.String())
+		}
+	}
+}
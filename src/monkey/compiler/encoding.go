@@ -0,0 +1,292 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"monkey/code"
+	"monkey/object"
+)
+
+// Serialized bytecode, conventionally stored in .mbc files, is laid out as
+//
+//	magic "MBC\x00" | format version (uint16) | code.Version (uint16)
+//	| body | CRC-32 (IEEE) of everything before it (uint32)
+//
+// Fixed-width fields are big endian like instruction operands. The body
+// holds the instructions, the line table, the builtin names and the
+// constant pool; lengths and counts in it are uvarints. Each constant
+// starts with a tag byte saying how it is encoded.
+const (
+	bytecodeMagic         = "MBC\x00"
+	bytecodeFormatVersion = 1
+)
+
+const (
+	tagInteger byte = iota + 1
+	tagString
+	tagCompiledFunction
+)
+
+// ErrInvalidBytecode is wrapped by every error UnmarshalBinary returns.
+var ErrInvalidBytecode = errors.New("invalid bytecode")
+
+// MarshalBinary encodes b in the portable bytecode format.
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	var w bytecodeWriter
+	w.buf.WriteString(bytecodeMagic)
+	w.uint16(bytecodeFormatVersion)
+	w.uint16(code.Version)
+
+	w.bytes(b.Instructions)
+	w.lines(b.Lines)
+	w.uvarint(uint64(len(b.Builtins)))
+	for _, name := range b.Builtins {
+		w.string(name)
+	}
+	w.uvarint(uint64(len(b.Constans)))
+	for i, constant := range b.Constans {
+		err := w.constant(constant)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(w.buf.Bytes()))
+	w.buf.Write(sum[:])
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes bytecode produced by MarshalBinary into b. It
+// fails on anything written by another format or opcode-set version.
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	headerLen := len(bytecodeMagic) + 4
+	if len(data) < headerLen+4 || string(data[:len(bytecodeMagic)]) != bytecodeMagic {
+		return fmt.Errorf("%w: not a Monkey bytecode file", ErrInvalidBytecode)
+	}
+	r := bytecodeReader{data: data[:len(data)-4], off: len(bytecodeMagic)}
+	if v := r.uint16(); v != bytecodeFormatVersion {
+		return fmt.Errorf("%w: format version %d, want %d", ErrInvalidBytecode, v, bytecodeFormatVersion)
+	}
+	if v := r.uint16(); v != code.Version {
+		return fmt.Errorf("%w: opcode set version %d, want %d", ErrInvalidBytecode, v, code.Version)
+	}
+	sum := binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(r.data) != sum {
+		return fmt.Errorf("%w: checksum mismatch", ErrInvalidBytecode)
+	}
+
+	decoded := Bytecode{}
+	decoded.Instructions = r.bytes()
+	decoded.Lines = r.lines()
+	n := r.count()
+	decoded.Builtins = make([]string, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		decoded.Builtins = append(decoded.Builtins, r.string())
+	}
+	n = r.count()
+	decoded.Constans = make([]object.Object, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		decoded.Constans = append(decoded.Constans, r.constant())
+	}
+	if r.err == nil && r.off != len(r.data) {
+		r.fail("%d trailing bytes", len(r.data)-r.off)
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	*b = decoded
+	return nil
+}
+
+type bytecodeWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *bytecodeWriter) uint16(v uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *bytecodeWriter) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (w *bytecodeWriter) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (w *bytecodeWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *bytecodeWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *bytecodeWriter) lines(lines code.LineTable) {
+	w.uvarint(uint64(len(lines)))
+	for _, entry := range lines {
+		w.uvarint(uint64(entry.Offset))
+		w.uvarint(uint64(entry.Line))
+		w.uvarint(uint64(entry.Column))
+	}
+}
+
+func (w *bytecodeWriter) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		w.buf.WriteByte(tagInteger)
+		w.varint(obj.Value)
+	case *object.String:
+		w.buf.WriteByte(tagString)
+		w.string(obj.Value)
+	case *object.CompiledFunction:
+		w.buf.WriteByte(tagCompiledFunction)
+		w.bytes(obj.Instructions)
+		w.uvarint(uint64(obj.NumLocals))
+		w.uvarint(uint64(obj.NumParameters))
+		w.string(obj.Name)
+		w.lines(obj.Lines)
+	default:
+		return fmt.Errorf("cannot serialize %s", obj.Type())
+	}
+	return nil
+}
+
+// bytecodeReader decodes the body. The first error sticks: later reads
+// return zero values, so callers check err once at the end.
+type bytecodeReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *bytecodeReader) fail(format string, a ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s at offset %d", ErrInvalidBytecode, fmt.Sprintf(format, a...), r.off)
+	}
+}
+
+func (r *bytecodeReader) uint16() uint16 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data)-r.off < 2 {
+		r.fail("truncated data")
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.data[r.off:])
+	r.off += 2
+	return v
+}
+
+func (r *bytecodeReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.off:])
+	if n <= 0 {
+		r.fail("malformed integer")
+		return 0
+	}
+	r.off += n
+	return v
+}
+
+func (r *bytecodeReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data[r.off:])
+	if n <= 0 {
+		r.fail("malformed integer")
+		return 0
+	}
+	r.off += n
+	return v
+}
+
+// count reads a length and checks that at least that many bytes are left,
+// since every counted item takes one byte or more. This keeps corrupted
+// lengths from triggering huge allocations.
+func (r *bytecodeReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.data)-r.off) {
+		r.fail("length %d exceeds remaining data", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *bytecodeReader) bytes() []byte {
+	n := r.count()
+	if r.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, r.data[r.off:])
+	r.off += n
+	return b
+}
+
+func (r *bytecodeReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *bytecodeReader) int() int {
+	v := r.uvarint()
+	if v > uint64(^uint(0)>>1) {
+		r.fail("value %d out of range", v)
+		return 0
+	}
+	return int(v)
+}
+
+func (r *bytecodeReader) lines() code.LineTable {
+	n := r.count()
+	lines := make(code.LineTable, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		lines = append(lines, code.LineEntry{Offset: r.int(), Line: r.int(), Column: r.int()})
+	}
+	return lines
+}
+
+func (r *bytecodeReader) constant() object.Object {
+	if r.err != nil {
+		return nil
+	}
+	if r.off >= len(r.data) {
+		r.fail("truncated data")
+		return nil
+	}
+	tag := r.data[r.off]
+	r.off++
+	switch tag {
+	case tagInteger:
+		return &object.Integer{Value: r.varint()}
+	case tagString:
+		return &object.String{Value: r.string()}
+	case tagCompiledFunction:
+		return &object.CompiledFunction{
+			Instructions:  r.bytes(),
+			NumLocals:     r.int(),
+			NumParameters: r.int(),
+			Name:          r.string(),
+			Lines:         r.lines(),
+		}
+	default:
+		r.off--
+		r.fail("unknown constant tag %d", tag)
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"monkey/object"
+	"reflect"
+	"testing"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `
+let greet = fn(name) { "hello " + name };
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+puts(greet("monkey"), fib(-10));
+`
+	comp := New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	original := comp.Bytecode()
+
+	data, err := original.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+	decoded := &Bytecode{}
+	err = decoded.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatalf("UnmarshalBinary failed: %s", err)
+	}
+
+	if !bytes.Equal(decoded.Instructions, original.Instructions) {
+		t.Errorf("wrong instructions.\nwant=%q\ngot=%q", original.Instructions, decoded.Instructions)
+	}
+	if !reflect.DeepEqual(decoded.Lines, original.Lines) {
+		t.Errorf("wrong lines. want=%v, got=%v", original.Lines, decoded.Lines)
+	}
+	if !reflect.DeepEqual(decoded.Builtins, original.Builtins) {
+		t.Errorf("wrong builtins. want=%v, got=%v", original.Builtins, decoded.Builtins)
+	}
+	if len(decoded.Constans) != len(original.Constans) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(original.Constans), len(decoded.Constans))
+	}
+	for i, want := range original.Constans {
+		got := decoded.Constans[i]
+		if fn, ok := want.(*object.CompiledFunction); ok {
+			gotFn, ok := got.(*object.CompiledFunction)
+			if !ok {
+				t.Fatalf("constant %d not CompiledFunction. got=%T", i, got)
+			}
+			if !bytes.Equal(gotFn.Instructions, fn.Instructions) || gotFn.NumLocals != fn.NumLocals ||
+				gotFn.NumParameters != fn.NumParameters || gotFn.Name != fn.Name ||
+				!reflect.DeepEqual(gotFn.Lines, fn.Lines) {
+				t.Errorf("constant %d differs. want=%+v, got=%+v", i, fn, gotFn)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("constant %d differs. want=%+v, got=%+v", i, want, got)
+		}
+	}
+}
+
+func TestBytecodeUnmarshalErrors(t *testing.T) {
+	comp := New()
+	err := comp.Compile(parse(`let f = fn(x) { x + "a" }; f("b")`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	data, err := comp.Bytecode().MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+
+	modified := func(i int, b byte) []byte {
+		out := append([]byte{}, data...)
+		out[i] = b
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{"empty", nil, "invalid bytecode: not a Monkey bytecode file"},
+		{"magic", modified(0, 'X'), "invalid bytecode: not a Monkey bytecode file"},
+		{"format", modified(5, 9), "invalid bytecode: format version 9, want 1"},
+		{"opcodes", modified(7, 9), "invalid bytecode: opcode set version 9, want 1"},
+		{"checksum", modified(len(data)-5, data[len(data)-5]^0xff), "invalid bytecode: checksum mismatch"},
+		{"truncated", data[:len(data)-1], "invalid bytecode: checksum mismatch"},
+	}
+
+	for _, tt := range tests {
+		var b Bytecode
+		err := b.UnmarshalBinary(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+		if !errors.Is(err, ErrInvalidBytecode) {
+			t.Errorf("%s: error does not wrap ErrInvalidBytecode", tt.name)
+		}
+	}
+
+	_, err = (&Bytecode{Constans: []object.Object{object.TRUE}}).MarshalBinary()
+	if err == nil || err.Error() != "constant 0: cannot serialize BOOLEAN" {
+		t.Errorf("wrong marshal error. got=%v", err)
+	}
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "sort"
+
 type SymbolScope string
 
 const (
@@ -57,6 +59,25 @@ func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	return symbol
 }
 
+// BuiltinNames returns the names of the builtins defined in the outermost
+// table, indexed by their symbol index. Unused indexes hold "".
+func (s *SymbolTable) BuiltinNames() []string {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	names := []string{}
+	for _, symbol := range s.store {
+		if symbol.Scope != BuiltinScope {
+			continue
+		}
+		for len(names) <= symbol.Index {
+			names = append(names, "")
+		}
+		names[symbol.Index] = symbol.Name
+	}
+	return names
+}
+
 func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
 	s.store[name] = symbol
@@ -85,3 +106,36 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 
 	return obj, ok
 }
+
+// Symbols returns the symbols defined in s itself, not in its outer
+// tables, ordered by scope and index.
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+	for _, symbol := range s.store {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Scope != symbols[j].Scope {
+			return symbols[i].Scope < symbols[j].Scope
+		}
+		return symbols[i].Index < symbols[j].Index
+	})
+	return symbols
+}
+
+// Clone returns a deep copy of s, so definitions made while compiling
+// against the copy leave s untouched.
+func (s *SymbolTable) Clone() *SymbolTable {
+	clone := &SymbolTable{
+		store:          make(map[string]Symbol, len(s.store)),
+		numDefinitions: s.numDefinitions,
+		FreeSymbols:    append([]Symbol{}, s.FreeSymbols...),
+	}
+	for name, symbol := range s.store {
+		clone.store[name] = symbol
+	}
+	if s.Outer != nil {
+		clone.Outer = s.Outer.Clone()
+	}
+	return clone
+}
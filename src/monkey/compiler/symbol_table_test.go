@@ -286,3 +286,54 @@ func TestShadowingFunctionName(t *testing.T) {
 		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
 	}
 }
+
+func TestBuiltinNames(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(1, "b")
+	global.DefineBuiltin(0, "a")
+	global.DefineBuiltin(3, "d")
+	global.Define("x")
+	local := NewEnclosedSymbolTable(global)
+
+	expected := []string{"a", "b", "", "d"}
+	names := local.BuiltinNames()
+	if len(names) != len(expected) {
+		t.Fatalf("wrong number of names. want=%v, got=%v", expected, names)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Errorf("wrong name at %d. want=%q, got=%q", i, name, names[i])
+		}
+	}
+}
+
+func TestCloneAndSymbols(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	a := global.Define("a")
+	b := global.Define("b")
+
+	clone := global.Clone()
+	c := clone.Define("c")
+	if c.Index != 2 {
+		t.Errorf("clone numbers definitions on. want=2, got=%d", c.Index)
+	}
+	if _, ok := global.Resolve("c"); ok {
+		t.Errorf("defining in the clone changed the original")
+	}
+
+	expected := []Symbol{
+		{Name: "len", Scope: BuiltinScope, Index: 0},
+		a,
+		b,
+	}
+	symbols := global.Symbols()
+	if len(symbols) != len(expected) {
+		t.Fatalf("wrong number of symbols. want=%d, got=%d", len(expected), len(symbols))
+	}
+	for i, sym := range expected {
+		if symbols[i] != sym {
+			t.Errorf("symbol %d wrong. want=%+v, got=%+v", i, sym, symbols[i])
+		}
+	}
+}
@@ -1,18 +1,28 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"monkey/ast"
 	"monkey/object"
+	"strings"
 )
 
+// MaxCallDepth is the deepest chain of nested function calls Eval allows
+// before reporting a stack overflow, matching vm.MaxFrames.
+const MaxCallDepth = 1024
+
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := env.Step(); err != nil {
+		return &object.Error{Message: err.Error(), Err: err}
+	}
+
 	switch node := node.(type) {
 
 	// Statements
@@ -81,6 +91,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Function{Parameters: params, Env: env, Body: body}
 
 	case *ast.CallExpression:
+		if member, ok := node.Function.(*ast.MemberExpression); ok {
+			if _, ok := lookupQualified(member, env); !ok {
+				return evalMethodCall(member, node.Arguments, env)
+			}
+		}
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
@@ -91,7 +106,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return ApplyFunction(function, args, env)
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
@@ -100,6 +115,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.Array{Elements: elements}
 
+	case *ast.MemberExpression:
+		if builtin, ok := lookupQualified(node, env); ok {
+			return builtin
+		}
+		obj := Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		result, err := object.GetAttr(obj, node.Property.Value)
+		return hostResult(result, err)
+
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -184,9 +210,9 @@ func evalInfixExpression(
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -233,6 +259,9 @@ func evalIntegerInfixExpression(
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
@@ -252,14 +281,19 @@ func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	if operator != "+" {
+	switch operator {
+	case "+":
+		leftVal := left.(*object.String).Value
+		rightVal := right.(*object.String).Value
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(object.Equal(left, right))
+	case "!=":
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
+	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
-
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
 }
 
 func evalIfExpression(
@@ -271,7 +305,7 @@ func evalIfExpression(
 		return condition
 	}
 
-	if isTruthy(condition) {
+	if object.IsTruthy(condition) {
 		return Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
 		return Eval(ie.Alternative, env)
@@ -288,24 +322,11 @@ func evalIdentifier(
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := env.Builtin(node.Value); ok {
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
-}
-
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
-		return false
-	case TRUE:
-		return true
-	case FALSE:
-		return false
-	default:
-		return true
-	}
+	return newError("identifier not found: %s", node.Value)
 }
 
 func newError(format string, a ...interface{}) *object.Error {
@@ -336,29 +357,50 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// ApplyFunction calls fn with args. caller is the environment the call is
+// made from; the call continues its call depth and context.
+func ApplyFunction(fn object.Object, args []object.Object, caller *object.Environment) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
+		if caller.Depth() >= MaxCallDepth {
+			return newError("stack overflow: maximum call depth %d exceeded", MaxCallDepth)
+		}
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+		extendedEnv := extendFunctionEnv(fn, args, caller)
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
-			return result
-		}
-		return NULL
+		result, err := fn.Call(hostContext(caller), args...)
+		return hostResult(result, err)
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// envCaller lets host functions call back into Eval from the environment
+// they were called in.
+type envCaller struct {
+	env *object.Environment
+}
+
+func (c envCaller) CallFunction(fn object.Object, args ...object.Object) (object.Object, error) {
+	result := ApplyFunction(fn, args, c.env)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, errObj
+	}
+	return result, nil
+}
+
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
+	caller *object.Environment,
 ) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+	env := object.NewCallEnvironment(fn.Env, caller)
 
 	for paramIdx, param := range fn.Parameters {
 		env.Set(param.Value, args[paramIdx])
@@ -375,12 +417,63 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
+// lookupQualified looks up http.get-style builtins not shadowed in env.
+func lookupQualified(node *ast.MemberExpression, env *object.Environment) (*object.Builtin, bool) {
+	name, ok := node.QualifiedName()
+	if !ok {
+		return nil, false
+	}
+	if _, ok := env.Get(name[:strings.Index(name, ".")]); ok {
+		return nil, false
+	}
+	return env.Builtin(name)
+}
+
+func evalMethodCall(
+	node *ast.MemberExpression,
+	arguments []ast.Expression,
+	env *object.Environment,
+) object.Object {
+	receiver := Eval(node.Object, env)
+	if isError(receiver) {
+		return receiver
+	}
+
+	args := evalExpressions(arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	result, err := object.CallMethod(hostContext(env), receiver, node.Property.Value, args...)
+	return hostResult(result, err)
+}
+
+// hostContext is the context host code runs under; it lets the host call
+// back into the evaluator.
+func hostContext(env *object.Environment) context.Context {
+	return object.WithCaller(env.Context(), envCaller{env})
+}
+
+// hostResult turns what host code returned into an evaluator value.
+func hostResult(result object.Object, err error) object.Object {
+	if err != nil {
+		return &object.Error{Message: err.Error(), Err: err}
+	}
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case object.IsHostObject(left):
+		result, err := left.(object.HostObject).Index(index)
+		return hostResult(result, err)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -402,43 +495,42 @@ func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash(len(node.Pairs))
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.AsHashable(key)
 		if !ok {
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := Eval(pair.Value, env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
+	key, ok := object.AsHashable(index)
 	if !ok {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return value
 }
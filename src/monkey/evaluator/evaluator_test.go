@@ -1,6 +1,10 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
@@ -67,6 +71,31 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" + "b" != "ab"`, false},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, true},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, 2] != [1, 2, 3]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`let x = if (false) { 1 }; x == if (false) { 2 }`, true},
+		{`[] == {}`, false},
+		{`1 == "1"`, false},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`let f = fn() { 1 }; f == f`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -217,10 +246,35 @@ if (10 > 1) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			`{[1, fn(x) { x }]: 1}`,
+			"unusable as hash key: ARRAY",
+		},
 		{
 			`999[1]`,
 			"index operator not supported: INTEGER",
 		},
+		{
+			// pairs are evaluated in source order
+			`{"b": 1 + true, "a": -true}`,
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			`let f = fn(x) { f(x + 1) }; f(0);`,
+			"stack overflow: maximum call depth 1024 exceeded",
+		},
+		{
+			"10 / 0",
+			"division by zero",
+		},
+		{
+			`fn(a, b) { a }(1)`,
+			"wrong number of arguments: want=2, got=1",
+		},
+		{
+			`[1, 2].map(fn(a, b) { a })`,
+			"wrong number of arguments: want=2, got=1",
+		},
 	}
 
 	for _, tt := range tests {
@@ -379,6 +433,12 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`rest([])`, nil},
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`map([[1], [1, 2]], len)`, []int{1, 2}},
+		{`map([1], fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, []int{3, 2, 1}},
 	}
 
 	for _, tt := range tests {
@@ -420,6 +480,39 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"Monkey".upper()`, "MONKEY"},
+		{`" a b ".trim().split(" ").len()`, "2"},
+		{`"abc".contains("b")`, "true"},
+		{`[3, 1, 2].sort().map(fn(x) { x * 2 }).join(",")`, "2,4,6"},
+		{`[1, 2].push(3).reduce(0, fn(acc, x) { acc + x })`, "6"},
+		{`[].first()`, "null"},
+		{`{"a": 1}.keys()`, "[a]"},
+		{`{"a": 1}.values().first()`, "1"},
+		{`{"a": 1}.has("a")`, "true"},
+		{`{"c": 1, "a": 2, "b": 3}.keys()`, "[c, a, b]"},
+		{`{"c": 1, "a": 2, "b": 3, "a": 4}`, "{c: 1, a: 4, b: 3}"},
+		{`let upper = "abc".upper; upper()`, "ABC"},
+		{`let a = [1]; let f = fn(x) { a.push(x) }; f(2).len()`, "2"},
+		{`"abc".upper(1)`, "ERROR: wrong number of arguments. got=1, want=0"},
+		{`"abc".split(1)`, "ERROR: argument to `split` must be STRING, got INTEGER"},
+		{`[1].push()`, "ERROR: wrong number of arguments. got=0, want=1"},
+		{`[1].sort(1, 2)`, "ERROR: wrong number of arguments. got=2, want=0 or 1"},
+		{`{}.missing()`, "ERROR: HASH has no method missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -523,14 +616,15 @@ func TestHashLiterals(t *testing.T) {
 		FALSE.HashKey():                            6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	for _, pair := range result.Pairs() {
+		expectedValue, ok := expected[pair.Key.(object.Hashable).HashKey()]
 		if !ok {
-			t.Errorf("no pair for given key in Pairs")
+			t.Errorf("unexpected key %s in Pairs", pair.Key.Inspect())
+			continue
 		}
 
 		testIntegerObject(t, pair.Value, expectedValue)
@@ -570,6 +664,22 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{[1, "a"]: 5}[[1, "a"]]`,
+			5,
+		},
+		{
+			`{[1, 2]: 5}[[2, 1]]`,
+			nil,
+		},
+		{
+			`{[1, 2]: 4, [1, 2]: 5}[[1, 2]]`,
+			5,
+		},
+		{
+			`{{"x": [1], "y": 2}: 5}[{"y": 2, "x": [1]}]`,
+			5,
+		},
 	}
 
 	for _, tt := range tests {
@@ -627,3 +737,155 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+func TestEvalBudgetAndCancellation(t *testing.T) {
+	input := `
+	let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } };
+	fib(20);`
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		env         *object.Environment
+		expectedErr error
+	}{
+		{object.NewEnvironmentWithContext(context.Background(), 1000), object.ErrBudgetExceeded},
+		{object.NewEnvironmentWithContext(canceled, 0), context.Canceled},
+	}
+	for _, tt := range tests {
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		evaluated := Eval(program, tt.env)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+		}
+		if errObj.Err != tt.expectedErr {
+			t.Errorf("wrong error. want=%v, got=%v", tt.expectedErr, errObj.Err)
+		}
+	}
+}
+
+func TestHostBuiltins(t *testing.T) {
+	registry := object.NewRegistry()
+	registry.Register("strings.repeat", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		s := args[0].(*object.String).Value
+		n := args[1].(*object.Integer).Value
+		out := ""
+		for i := int64(0); i < n; i++ {
+			out += s
+		}
+		return &object.String{Value: out}, nil
+	})
+	registry.Register("fail", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return nil, errors.New("host failure")
+	})
+
+	env := object.NewEnvironment()
+	env.SetBuiltins(registry)
+	evaluated := Eval(parse(`let f = fn() { fail() }; f()`), env)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "host failure" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	builtin, ok := env.Builtin("strings.repeat")
+	if !ok {
+		t.Fatalf("strings.repeat not visible in environment")
+	}
+	result := ApplyFunction(builtin, []object.Object{&object.String{Value: "ab"}, &object.Integer{Value: 3}}, env)
+	str, ok := result.(*object.String)
+	if !ok || str.Value != "ababab" {
+		t.Errorf("wrong result. got=%T(%+v)", result, result)
+	}
+
+	fn := Eval(parse(`fn(a, b) { a + b }`), env)
+	result = ApplyFunction(fn, []object.Object{&object.Integer{Value: 1}}, env)
+	errObj, ok = result.(*object.Error)
+	if !ok || errObj.Message != "wrong number of arguments: want=2, got=1" {
+		t.Errorf("wrong result of a call with too few arguments. got=%T(%+v)", result, result)
+	}
+}
+
+type testRequest struct {
+	path    string
+	headers map[string]string
+}
+
+func (r *testRequest) Type() object.ObjectType { return "REQUEST" }
+func (r *testRequest) Inspect() string         { return "request " + r.path }
+
+func (r *testRequest) GetAttr(name string) (object.Object, error) {
+	if name == "path" {
+		return &object.String{Value: r.path}, nil
+	}
+	return nil, fmt.Errorf("request has no attribute %s", name)
+}
+
+func (r *testRequest) SetAttr(name string, value object.Object) error {
+	return fmt.Errorf("request is read-only")
+}
+
+func (r *testRequest) CallMethod(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	if name != "header" || len(args) != 1 {
+		return nil, fmt.Errorf("request has no method %s/%d", name, len(args))
+	}
+	value, ok := r.headers[args[0].Inspect()]
+	if !ok {
+		return nil, nil
+	}
+	return &object.String{Value: value}, nil
+}
+
+func (r *testRequest) Index(key object.Object) (object.Object, error) {
+	return r.CallMethod(context.Background(), "header", key)
+}
+
+func TestHostObjects(t *testing.T) {
+	registry := object.NewRegistry()
+	registry.Register("request", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return &testRequest{path: "/", headers: map[string]string{"x": "1"}}, nil
+	})
+	registry.Register("http.status", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return &object.Integer{Value: 200}, nil
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`request().header("x")`, "1"},
+		{`let req = request(); req.path + req["x"]`, "/1"},
+		{`let f = fn(r) { r.header("y") }; f(request())`, nil},
+		{`http.status()`, 200},
+		{`let http = request(); http.status()`, "ERROR: request has no method status/0"},
+		{`request().body`, "ERROR: request has no attribute body"},
+		{`[1].missing`, "ERROR: ARRAY has no attribute missing"},
+		{`5.abs()`, "ERROR: INTEGER has no method abs"},
+	}
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetBuiltins(registry)
+		evaluated := Eval(parse(tt.input), env)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. want=%q, got=%q", expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
@@ -0,0 +1,501 @@
+// Package format prints Monkey programs in a canonical style: two space
+// indentation, one statement per line, only the parentheses the
+// precedence rules call for, and lists broken one element per line when
+// they do not fit in lineWidth columns or hold comments. Comments are kept
+// next to the statements and list elements they belong to.
+package format
+
+import (
+	"errors"
+	"io"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	indent    = "  "
+	lineWidth = 80
+)
+
+// Source formats the Monkey program src. It fails when src does not parse.
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New("parser errors:\n\t" + strings.Join(p.Errors(), "\n\t"))
+	}
+
+	var out strings.Builder
+	// the lexer skips a "#!" first line, so put it back
+	if strings.HasPrefix(string(src), "#!") {
+		line := string(src)
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+		out.WriteString(strings.TrimRight(line, " \t\r") + "\n")
+	}
+	err := Node(&out, program)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out.String()), nil
+}
+
+// Node writes node to w in canonical style. A program is written with its
+// comments and a final newline; other nodes are written without either.
+func Node(w io.Writer, node ast.Node) error {
+	p := &printer{}
+	switch node := node.(type) {
+	case *ast.Program:
+		p.comments = node.Comments
+		p.statementList(node.Statements, token.Position{}, true)
+		if p.out.Len() > 0 {
+			p.write("\n")
+		}
+	case ast.Statement:
+		p.statement(node, false)
+	case ast.Expression:
+		p.expr(node, parser.LOWEST)
+	}
+	_, err := io.WriteString(w, p.out.String())
+	return err
+}
+
+type printer struct {
+	out     strings.Builder
+	depth   int  // indentation level
+	col     int  // column the next character goes to, counting from 0
+	pending bool // a line was started and still needs its indentation
+
+	comments []*ast.Comment
+	next     int // index of the first comment not printed yet
+	lastLine int // source line of the last node or comment printed
+}
+
+func (p *printer) write(s string) {
+	if s == "" {
+		return
+	}
+	if p.pending {
+		p.pending = false
+		p.write(strings.Repeat(indent, p.depth))
+	}
+	p.out.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.col = utf8.RuneCountInString(s[i+1:])
+	} else {
+		p.col += utf8.RuneCountInString(s)
+	}
+}
+
+// newline ends the line; the next write indents the new one.
+func (p *printer) newline() {
+	p.out.WriteString("\n")
+	p.col = 0
+	p.pending = true
+}
+
+// try returns a printer to print a layout on trial. If the layout works
+// out, commit adds what it printed to p.
+func (p *printer) try() *printer {
+	return &printer{
+		depth:    p.depth,
+		col:      p.col,
+		pending:  p.pending,
+		comments: p.comments,
+		next:     p.next,
+		lastLine: p.lastLine,
+	}
+}
+
+func (p *printer) commit(q *printer) {
+	p.out.WriteString(q.out.String())
+	p.col, p.pending = q.col, q.pending
+	p.next, p.lastLine = q.next, q.lastLine
+}
+
+// fits reports whether q, tried at column col, stays within the line width
+// on the line it started on and the line it ended on.
+func (q *printer) fits(col int) bool {
+	first := q.out.String()
+	if i := strings.IndexByte(first, '\n'); i >= 0 {
+		first = first[:i]
+	}
+	return col+utf8.RuneCountInString(first) <= lineWidth && q.col <= lineWidth
+}
+
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// commentBefore reports whether the next comment comes before pos. An
+// invalid pos stands for the end of the file.
+func (p *printer) commentBefore(pos token.Position) bool {
+	if p.next >= len(p.comments) {
+		return false
+	}
+	return !pos.IsValid() || before(p.comments[p.next].Pos(), pos)
+}
+
+// hasComments reports whether comments not printed yet lie between from
+// and to.
+func (p *printer) hasComments(from, to token.Position) bool {
+	for _, c := range p.comments[p.next:] {
+		if before(to, c.Pos()) {
+			break
+		}
+		if before(from, c.Pos()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *printer) comment() {
+	c := p.comments[p.next]
+	p.write(c.Token.Literal)
+	// a comment moved out of a statement must not look like a blank line
+	if c.Pos().Line > p.lastLine {
+		p.lastLine = c.Pos().Line
+	}
+	p.next++
+}
+
+// trailingComment prints the next comment at the end of the line when the
+// source has it on the line printed last, before end, the closing bracket
+// of the enclosing block or list.
+func (p *printer) trailingComment(end token.Position) {
+	if p.commentBefore(end) && p.comments[p.next].Pos().Line == p.lastLine {
+		p.write(" ")
+		p.comment()
+	}
+}
+
+// statementList prints stmts one per line, each preceded by its comments,
+// keeping a blank line where the source has blank lines. It goes on with
+// the comments before end, the closing brace of a block; top is set for
+// the statements of a program, which take every comment left.
+func (p *printer) statementList(stmts []ast.Statement, end token.Position, top bool) {
+	first := true
+	startLine := func(line int) {
+		if !first || !top {
+			p.newline()
+		}
+		if !first && line-p.lastLine > 1 {
+			p.newline()
+		}
+		first = false
+	}
+
+	for i, stmt := range stmts {
+		for p.commentBefore(stmt.Pos()) {
+			startLine(p.comments[p.next].Pos().Line)
+			p.comment()
+		}
+		startLine(stmt.Pos().Line)
+
+		semicolon := true
+		if es, ok := stmt.(*ast.ExpressionStatement); ok {
+			last := i == len(stmts)-1
+			switch {
+			case last && !top:
+				// the value of the block
+				semicolon = false
+			case isIf(es.Expression):
+				semicolon = !last && p.continues(stmts[i+1])
+			}
+		}
+		p.statement(stmt, semicolon)
+		p.lastLine = lastLine(stmt)
+		p.trailingComment(end)
+	}
+
+	for (top || end.IsValid()) && p.commentBefore(end) {
+		startLine(p.comments[p.next].Pos().Line)
+		p.comment()
+	}
+}
+
+func isIf(exp ast.Expression) bool {
+	_, ok := exp.(*ast.IfExpression)
+	return ok
+}
+
+// continues reports whether stmt, printed right after an expression, would
+// be parsed as part of it, like "-1" turning into a subtraction.
+func (p *printer) continues(stmt ast.Statement) bool {
+	q := p.try()
+	q.comments, q.next = nil, 0
+	q.statement(stmt, false)
+	s := strings.TrimLeft(q.out.String(), " ")
+	return s != "" && strings.ContainsRune("-([", rune(s[0]))
+}
+
+func (p *printer) statement(stmt ast.Statement, semicolon bool) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let " + stmt.Name.Value + " = ")
+		p.expr(stmt.Value, parser.LOWEST)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expr(stmt.ReturnValue, parser.LOWEST)
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expr(stmt.Expression, parser.LOWEST)
+		if semicolon {
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+
+// block prints a block on one line when it holds a single statement that
+// fits, and one statement per line otherwise.
+func (p *printer) block(b *ast.BlockStatement) {
+	comments := p.hasComments(b.Token.Pos, b.Rbrace)
+	if len(b.Statements) == 0 && !comments {
+		p.write("{}")
+		return
+	}
+	if len(b.Statements) == 1 && !comments {
+		q := p.try()
+		q.write("{ ")
+		q.statement(b.Statements[0], false)
+		q.write(" }")
+		if !strings.Contains(q.out.String(), "\n") && q.fits(p.col) {
+			p.commit(q)
+			return
+		}
+	}
+
+	p.write("{")
+	p.depth++
+	p.statementList(b.Statements, b.Rbrace, false)
+	p.depth--
+	p.newline()
+	p.write("}")
+}
+
+// precedence returns the binding power of exp, the lowest precedence an
+// operator around it may have without exp needing parentheses.
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return infixPrecedence(exp.Operator)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression, *ast.MemberExpression:
+		return parser.INDEX
+	default:
+		return parser.INDEX + 1
+	}
+}
+
+func infixPrecedence(operator string) int {
+	switch operator {
+	case "==", "!=":
+		return parser.EQUALS
+	case "<", ">":
+		return parser.LESSGREATER
+	case "+", "-":
+		return parser.SUM
+	default:
+		return parser.PRODUCT
+	}
+}
+
+// expr prints exp, in parentheses when it binds less tightly than prec.
+func (p *printer) expr(exp ast.Expression, prec int) {
+	if precedence(exp) < prec {
+		p.write("(")
+		p.expr(exp, parser.LOWEST)
+		p.write(")")
+		return
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+	case *ast.IntegerLiteral:
+		p.write(exp.Token.Literal)
+	case *ast.Boolean:
+		p.write(exp.Token.Literal)
+	case *ast.StringLiteral:
+		p.write(`"` + exp.Value + `"`)
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		if _, ok := exp.Right.(*ast.PrefixExpression); ok {
+			// "-(-x)" rather than "--x"
+			p.write("(")
+			p.expr(exp.Right, parser.LOWEST)
+			p.write(")")
+			break
+		}
+		p.expr(exp.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		prec := infixPrecedence(exp.Operator)
+		p.expr(exp.Left, prec)
+		p.write(" " + exp.Operator + " ")
+		// operators associate to the left
+		p.expr(exp.Right, prec+1)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expr(exp.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		params := []string{}
+		for _, param := range exp.Parameters {
+			params = append(params, param.Value)
+		}
+		p.write("fn(" + strings.Join(params, ", ") + ") ")
+		p.block(exp.Body)
+	case *ast.CallExpression:
+		p.expr(exp.Function, parser.CALL)
+		p.list("(", ")", exp.Token.Pos, exp.Rparen, len(exp.Arguments), func(i int) ast.Expression {
+			return exp.Arguments[i]
+		}, nil)
+	case *ast.ArrayLiteral:
+		p.list("[", "]", exp.Token.Pos, exp.Rbracket, len(exp.Elements), func(i int) ast.Expression {
+			return exp.Elements[i]
+		}, nil)
+	case *ast.HashLiteral:
+		p.list("{", "}", exp.Token.Pos, exp.Rbrace, len(exp.Pairs), func(i int) ast.Expression {
+			return exp.Pairs[i].Key
+		}, func(i int) ast.Expression {
+			return exp.Pairs[i].Value
+		})
+	case *ast.IndexExpression:
+		p.expr(exp.Left, parser.CALL)
+		p.write("[")
+		p.expr(exp.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.MemberExpression:
+		p.expr(exp.Object, parser.CALL)
+		p.write("." + exp.Property.Value)
+	}
+}
+
+// list prints n elements between open and close, which are at the source
+// positions from and to. element returns the i-th element; for hash
+// literals it returns the key and value the value. The elements go on one
+// line when they fit and hold no comments, and one per line otherwise.
+func (p *printer) list(open, close string, from, to token.Position, n int, element, value func(i int) ast.Expression) {
+	item := func(p *printer, i int) {
+		p.expr(element(i), parser.LOWEST)
+		if value != nil {
+			p.write(": ")
+			p.expr(value(i), parser.LOWEST)
+		}
+	}
+
+	if n == 0 && !p.hasComments(from, to) {
+		p.write(open + close)
+		return
+	}
+	if !p.hasComments(from, to) {
+		q := p.try()
+		q.write(open)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				q.write(", ")
+			}
+			item(q, i)
+		}
+		q.write(close)
+		if q.fits(p.col) {
+			p.commit(q)
+			return
+		}
+	}
+
+	p.write(open)
+	p.depth++
+	for i := 0; i < n; i++ {
+		for p.commentBefore(firstPos(element(i))) {
+			p.newline()
+			p.comment()
+		}
+		p.newline()
+		item(p, i)
+		if i < n-1 {
+			p.write(",")
+		}
+		if value != nil {
+			p.lastLine = lastLine(value(i))
+		} else {
+			p.lastLine = lastLine(element(i))
+		}
+		// a comment after later elements on the same line belongs to the
+		// last of them
+		end := to
+		if i < n-1 {
+			end = firstPos(element(i + 1))
+		}
+		p.trailingComment(end)
+	}
+	for to.IsValid() && p.commentBefore(to) {
+		p.newline()
+		p.comment()
+	}
+	p.depth--
+	p.newline()
+	p.write(close)
+}
+
+// firstPos returns the position of the first token of exp.
+func firstPos(exp ast.Expression) token.Position {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return firstPos(exp.Left)
+	case *ast.CallExpression:
+		return firstPos(exp.Function)
+	case *ast.IndexExpression:
+		return firstPos(exp.Left)
+	case *ast.MemberExpression:
+		return firstPos(exp.Object)
+	default:
+		return exp.Pos()
+	}
+}
+
+// lastLine returns the last source line node spans.
+func lastLine(node ast.Node) int {
+	line := 0
+	more := func(pos token.Position) {
+		if pos.Line > line {
+			line = pos.Line
+		}
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case nil:
+			return false
+		case *ast.BlockStatement:
+			more(n.Rbrace)
+		case *ast.CallExpression:
+			more(n.Rparen)
+		case *ast.ArrayLiteral:
+			more(n.Rbracket)
+		case *ast.IndexExpression:
+			more(n.Rbracket)
+		case *ast.HashLiteral:
+			more(n.Rbrace)
+		}
+		more(n.Pos())
+		return true
+	})
+	return line
+}
@@ -0,0 +1,190 @@
+package format
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1", "let x = 1;\n"},
+		{"  puts( 1 )  ;puts(2)", "puts(1);\nputs(2);\n"},
+		{"", ""},
+		{"(1 + 2) * 3; 1 + (2 * 3); (1 + 2) + 3; 1 - (2 - 3)", "(1 + 2) * 3;\n1 + 2 * 3;\n1 + 2 + 3;\n1 - (2 - 3);\n"},
+		{"-(a + b); -(-a); !(a == b); (-a)[0]; -a[0]", "-(a + b);\n-(-a);\n!(a == b);\n(-a)[0];\n-a[0];\n"},
+		{"(a + b).len(); a.b.c(1)(2)[3]", "(a + b).len();\na.b.c(1)(2)[3];\n"},
+		{`{"b": 2, "a": [1,2]}`, "{\"b\": 2, \"a\": [1, 2]};\n"},
+		{"fn(){}; fn(x,y){x+y}", "fn() {};\nfn(x, y) { x + y };\n"},
+		{
+			"let f = fn(x) { let y = x; return y; };",
+			"let f = fn(x) {\n  let y = x;\n  return y;\n};\n",
+		},
+		{
+			"if (x > 1) { x } else { 1 }\nputs(x)",
+			"if (x > 1) { x } else { 1 }\nputs(x);\n",
+		},
+		{
+			// the semicolon keeps the next statement from being an index
+			"if (x) { 1 }; [1]",
+			"if (x) { 1 };\n[1];\n",
+		},
+		{
+			"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;",
+			"let a = 1;\n\nlet b = 2;\nlet c = 3;\n",
+		},
+		{
+			`let numbers = [1111111111, 2222222222, 3333333333, 4444444444, 5555555555, 6666666666];`,
+			"let numbers = [\n  1111111111,\n  2222222222,\n  3333333333,\n  4444444444,\n  5555555555,\n  6666666666\n];\n",
+		},
+		{
+			"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };",
+			"let fib = fn(n) {\n  if (n < 2) { return n; }\n  fib(n - 1) + fib(n - 2)\n};\n",
+		},
+		{
+			"map(xs, fn(x) { let y = x * 2; y })",
+			"map(xs, fn(x) {\n  let y = x * 2;\n  y\n});\n",
+		},
+		{
+			"#!/usr/bin/env monkey\nputs(args)",
+			"#!/usr/bin/env monkey\nputs(args);\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) returned error: %s", tt.input, err)
+			continue
+		}
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"// header\n\nlet x = 1; // one\n// about y\nlet y = 2;\n// the end",
+			"// header\n\nlet x = 1; // one\n// about y\nlet y = 2;\n// the end\n",
+		},
+		{
+			"let f = fn() {\n// nothing yet\n};",
+			"let f = fn() {\n  // nothing yet\n};\n",
+		},
+		{
+			"let f = fn(x) { x // the same\n};",
+			"let f = fn(x) {\n  x // the same\n};\n",
+		},
+		{
+			"let f = fn(x) { x }; // identity",
+			"let f = fn(x) { x }; // identity\n",
+		},
+		{
+			"let a = [1, // one\n2];",
+			"let a = [\n  1, // one\n  2\n];\n",
+		},
+		{
+			"let h = {\n// first\n\"a\": 1,\n\"b\": 2 // second\n// done\n};",
+			"let h = {\n  // first\n  \"a\": 1,\n  \"b\": 2 // second\n  // done\n};\n",
+		},
+		{
+			"f(a, b, // ab\nc);",
+			"f(\n  a,\n  b, // ab\n  c\n);\n",
+		},
+		{
+			"let h = {\"a\": 1, \"b\": 2, // ab\n\"c\": 3};",
+			"let h = {\n  \"a\": 1,\n  \"b\": 2, // ab\n  \"c\": 3\n};\n",
+		},
+		{
+			// comments inside an expression move after it rather than get lost
+			"let x = 1 + // one\n 2;\nx",
+			"let x = 1 + 2;\n// one\nx;\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) returned error: %s", tt.input, err)
+			continue
+		}
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestIdempotent checks that formatting formatted source changes nothing
+// and that formatting does not change what the program means.
+func TestIdempotent(t *testing.T) {
+	inputs := []string{
+		`let fibonacci = fn(x) { if (x == 0) { 0 } else { if (x == 1) { return 1; } else { fibonacci(x - 1) + fibonacci(x - 2); } } }; fibonacci(15);`,
+		`let map = fn(arr, f) { let iter = fn(arr, accumulated) { if (len(arr) == 0) { accumulated } else { iter(rest(arr), push(accumulated, f(first(arr)))); } }; iter(arr, []); };`,
+		`let people = [{"name": "Alice"}, {"name": "Anna"}]; people[0]["name"];`,
+		"// counts\nlet counter = fn(x) {\n  // stop at 100\n  if (x > 100) { return true; } // done\n  counter(x + 1);\n};\n\n\ncounter(0) // start\n",
+		`let reduce = fn(arr, initial, f) { let iter = fn(arr, result) { if (len(arr) == 0) { result } else { iter(rest(arr), f(result, first(arr))) } }; iter(arr, initial) }; let sum = fn(arr) { reduce(arr, 0, fn(initial, el) { initial + el }) }; sum([1, 2, 3, 4, 5]);`,
+		`-(1 + 2) * -3 / (4 - -5) < 6 == !(7 > 8) != true; "a".upper().len(); [1, 2, 3][1 + 1]; {"key": fn(x) { x }}["key"](1)`,
+		"let a = [\"a very long string to force a break\", \"another very long string that does not fit\", fn(x) { x * 2 }];",
+		"if (a) { b } else { c };\n-1;\n(fn() { 1 })()",
+	}
+
+	for _, input := range inputs {
+		once, err := Source([]byte(input))
+		if err != nil {
+			t.Errorf("Source(%q) returned error: %s", input, err)
+			continue
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Errorf("Source(%q) returned error: %s", once, err)
+			continue
+		}
+		if string(once) != string(twice) {
+			t.Errorf("formatting is not idempotent.\nonce=  %q\ntwice= %q", once, twice)
+		}
+		if parse(t, input) != parse(t, string(once)) {
+			t.Errorf("formatting changed the program.\nbefore= %s\nafter=  %s", parse(t, input), parse(t, string(once)))
+		}
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program.String()
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source([]byte("let = 1;"))
+	if err == nil || !strings.Contains(err.Error(), "expected next token to be IDENT") {
+		t.Errorf("expected a parser error, got=%v", err)
+	}
+}
+
+func TestNode(t *testing.T) {
+	p := parser.New(lexer.New("(a + b) * c"))
+	program := p.ParseProgram()
+	exp := program.Statements[0].(*ast.ExpressionStatement).Expression
+
+	var out strings.Builder
+	err := Node(&out, exp)
+	if err != nil {
+		t.Fatalf("Node returned error: %s", err)
+	}
+	if out.String() != "(a + b) * c" {
+		t.Errorf("Node wrong. got=%q", out.String())
+	}
+}
@@ -30,6 +30,7 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+req.header("x")
 `
 
 	tests := []struct {
@@ -122,6 +123,12 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.IDENT, "req"},
+		{token.DOT, "."},
+		{token.IDENT, "header"},
+		{token.LPAREN, "("},
+		{token.STRING, "x"},
+		{token.RPAREN, ")"},
 		{token.EOF, ""},
 	}
 
@@ -141,3 +148,97 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "ab"
+`
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+	}{
+		{token.LET, token.Position{Line: 1, Column: 1}},
+		{token.IDENT, token.Position{Line: 1, Column: 5}},
+		{token.ASSIGN, token.Position{Line: 1, Column: 7}},
+		{token.INT, token.Position{Line: 1, Column: 9}},
+		{token.SEMICOLON, token.Position{Line: 1, Column: 10}},
+		{token.IDENT, token.Position{Line: 2, Column: 3}},
+		{token.PLUS, token.Position{Line: 2, Column: 5}},
+		{token.STRING, token.Position{Line: 2, Column: 7}},
+		{token.EOF, token.Position{Line: 3, Column: 1}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%s, got=%s",
+				i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestShebangLine(t *testing.T) {
+	l := New("#!/usr/bin/env monkey\nlet x;")
+
+	tok := l.NextToken()
+	if tok.Type != token.LET {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.LET, tok.Type)
+	}
+	if tok.Pos != (token.Position{Line: 2, Column: 1}) {
+		t.Fatalf("position wrong. expected=2:1, got=%s", tok.Pos)
+	}
+
+	l = New("x # y")
+	l.NextToken()
+	if tok := l.NextToken(); tok.Type != token.ILLEGAL {
+		t.Fatalf("# outside the first line should be ILLEGAL, got=%q", tok.Type)
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	l := New(`"abc`)
+
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != `"abc` {
+		t.Fatalf("wrong token. expected=ILLEGAL %q, got=%s %q", `"abc`, tok.Type, tok.Literal)
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+}
+
+func TestComments(t *testing.T) {
+	l := New("// header\nlet x = 10 / 2; // five \n//last")
+
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SLASH, token.INT, token.SEMICOLON, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+
+	comments := []token.Token{
+		{Type: token.COMMENT, Literal: "// header", Pos: token.Position{Line: 1, Column: 1}},
+		{Type: token.COMMENT, Literal: "// five", Pos: token.Position{Line: 2, Column: 17}},
+		{Type: token.COMMENT, Literal: "//last", Pos: token.Position{Line: 3, Column: 1}},
+	}
+	got := l.Comments()
+	if len(got) != len(comments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(comments), len(got))
+	}
+	for i, c := range comments {
+		if got[i] != c {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, c, got[i])
+		}
+	}
+}
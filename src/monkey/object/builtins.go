@@ -1,6 +1,10 @@
 package object
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"sort"
+)
 
 var Builtins = []struct {
 	Name    string
@@ -83,14 +87,14 @@ var Builtins = []struct {
 	{
 		"rest",
 		&Builtin{
-			Fn: func(args ...Object) Object {
+			HostFn: func(ctx context.Context, args ...Object) (Object, error) {
 				if len(args) != 1 {
 					return newError("wrong number of arguments. got=%d, want=1",
-						len(args))
+						len(args)), nil
 				}
 				if args[0].Type() != ARRAY_OBJ {
 					return newError("argument to `rest` must be ARRAY, got %s",
-						args[0].Type())
+						args[0].Type()), nil
 				}
 
 				arr := args[0].(*Array)
@@ -98,24 +102,24 @@ var Builtins = []struct {
 				if length > 0 {
 					newElements := make([]Object, length-1)
 					copy(newElements, arr.Elements[1:length])
-					return &Array{Elements: newElements}
+					return tracked(ctx, &Array{Elements: newElements})
 				}
 
-				return nil
+				return nil, nil
 			},
 		},
 	},
 	{
 		"push",
 		&Builtin{
-			Fn: func(args ...Object) Object {
+			HostFn: func(ctx context.Context, args ...Object) (Object, error) {
 				if len(args) != 2 {
 					return newError("wrong number of arguments. got=%d, want=2",
-						len(args))
+						len(args)), nil
 				}
 				if args[0].Type() != ARRAY_OBJ {
 					return newError("argument to `push` must be ARRAY, got %s",
-						args[0].Type())
+						args[0].Type()), nil
 				}
 
 				arr := args[0].(*Array)
@@ -125,10 +129,154 @@ var Builtins = []struct {
 				copy(newElements, arr.Elements)
 				newElements[length] = args[1]
 
-				return &Array{Elements: newElements}
+				return tracked(ctx, &Array{Elements: newElements})
 			},
 		},
 	},
+	{
+		"map",
+		&Builtin{
+			HostFn: func(ctx context.Context, args ...Object) (Object, error) {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2",
+						len(args)), nil
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `map` must be ARRAY, got %s",
+						args[0].Type()), nil
+				}
+				caller, err := callerFor(ctx, "map")
+				if err != nil {
+					return nil, err
+				}
+
+				arr := args[0].(*Array)
+				newElements := make([]Object, len(arr.Elements))
+				for i, el := range arr.Elements {
+					newElements[i], err = caller.CallFunction(args[1], el)
+					if err != nil {
+						return nil, err
+					}
+				}
+				return tracked(ctx, &Array{Elements: newElements})
+			},
+		},
+	},
+	{
+		"reduce",
+		&Builtin{
+			HostFn: func(ctx context.Context, args ...Object) (Object, error) {
+				if len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=3",
+						len(args)), nil
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `reduce` must be ARRAY, got %s",
+						args[0].Type()), nil
+				}
+				caller, err := callerFor(ctx, "reduce")
+				if err != nil {
+					return nil, err
+				}
+
+				result := args[1]
+				for _, el := range args[0].(*Array).Elements {
+					result, err = caller.CallFunction(args[2], result, el)
+					if err != nil {
+						return nil, err
+					}
+				}
+				return result, nil
+			},
+		},
+	},
+	{
+		"sort",
+		&Builtin{
+			HostFn: func(ctx context.Context, args ...Object) (Object, error) {
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=1 or 2",
+						len(args)), nil
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `sort` must be ARRAY, got %s",
+						args[0].Type()), nil
+				}
+
+				arr := args[0].(*Array)
+				newElements := make([]Object, len(arr.Elements))
+				copy(newElements, arr.Elements)
+
+				if len(args) == 1 {
+					if errObj := sortNatural(newElements); errObj != nil {
+						return errObj, nil
+					}
+					return tracked(ctx, &Array{Elements: newElements})
+				}
+
+				// sort(arr, less) orders by the user function less(a, b).
+				caller, err := callerFor(ctx, "sort")
+				if err != nil {
+					return nil, err
+				}
+				var callErr error
+				sort.SliceStable(newElements, func(i, j int) bool {
+					if callErr != nil {
+						return false
+					}
+					less, err := caller.CallFunction(args[1], newElements[i], newElements[j])
+					if err != nil {
+						callErr = err
+						return false
+					}
+					return IsTruthy(less)
+				})
+				if callErr != nil {
+					return nil, callErr
+				}
+				return tracked(ctx, &Array{Elements: newElements})
+			},
+		},
+	},
+}
+
+// tracked reports obj, newly created by a builtin, to the Tracker in ctx
+// and returns it.
+func tracked(ctx context.Context, obj Object) (Object, error) {
+	err := Track(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func callerFor(ctx context.Context, name string) (Caller, error) {
+	caller, ok := CallerFrom(ctx)
+	if !ok {
+		return nil, fmt.Errorf("`%s` cannot call functions outside of a running script", name)
+	}
+	return caller, nil
+}
+
+// sortNatural sorts arrays holding only integers or only strings.
+func sortNatural(elements []Object) *Error {
+	if len(elements) == 0 {
+		return nil
+	}
+	elemType := elements[0].Type()
+	for _, el := range elements {
+		if el.Type() != elemType || (elemType != INTEGER_OBJ && elemType != STRING_OBJ) {
+			return newError("`sort` without a function needs all INTEGER or all STRING, got %s",
+				el.Type())
+		}
+	}
+	sort.SliceStable(elements, func(i, j int) bool {
+		if elemType == INTEGER_OBJ {
+			return elements[i].(*Integer).Value < elements[j].(*Integer).Value
+		}
+		return elements[i].(*String).Value < elements[j].(*String).Value
+	})
+	return nil
 }
 
 func GetBuiltinByName(name string) *Builtin {
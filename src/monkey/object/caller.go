@@ -0,0 +1,22 @@
+package object
+
+import "context"
+
+// Caller lets host functions call back into the engine running the script,
+// e.g. to apply a function the script passed as an argument.
+type Caller interface {
+	CallFunction(fn Object, args ...Object) (Object, error)
+}
+
+type callerKey struct{}
+
+// WithCaller returns a context carrying c. Engines use it for the context
+// they hand to host functions.
+func WithCaller(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+func CallerFrom(ctx context.Context) (Caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(Caller)
+	return c, ok
+}
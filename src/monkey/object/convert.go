@@ -0,0 +1,532 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	objectType  = reflect.TypeOf((*Object)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// FromGo converts a Go value to a Monkey object.
+//
+// nil becomes null, bools, integers and strings their Monkey counterparts,
+// slices and arrays become arrays, and maps and structs become hashes.
+// Struct fields are keyed by their name or by a `monkey:"name"` tag; the
+// tag "-" leaves a field out. Pointers are followed, Objects are returned
+// as they are and functions are wrapped with WrapFunc. Values that
+// contain themselves cannot be converted.
+func FromGo(v interface{}) (Object, error) {
+	if obj, ok := v.(Object); ok {
+		return obj, nil
+	}
+	if v == nil {
+		return NULL, nil
+	}
+	return fromValue(reflect.ValueOf(v), map[visit]bool{})
+}
+
+// visit identifies a pointer, map or slice fromValue is inside of.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+func fromValue(v reflect.Value, visiting map[visit]bool) (Object, error) {
+	if v.Type().Implements(objectType) {
+		if nillable(v.Kind()) && v.IsNil() {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if !v.IsNil() {
+			key := visit{ptr: v.Pointer(), typ: v.Type()}
+			if v.Kind() == reflect.Slice {
+				key.len = v.Len()
+			}
+			if visiting[key] {
+				return nil, fmt.Errorf("cannot convert Go %s: it contains itself", v.Type())
+			}
+			visiting[key] = true
+			defer delete(visiting, key)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("cannot convert %d to INTEGER: out of range", v.Uint())
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NULL, nil
+		}
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			el, err := fromValue(v.Index(i), visiting)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		pairs := make([]HashPair, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := fromValue(iter.Key(), visiting)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := AsHashable(key); !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := fromValue(iter.Value(), visiting)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, HashPair{Key: key, Value: value})
+		}
+		// Go maps have no order, so sort the keys to give the hash one
+		// that does not change between runs.
+		sort.Slice(pairs, func(i, j int) bool {
+			return keyLess(pairs[i].Key, pairs[j].Key)
+		})
+		hash := NewHash(len(pairs))
+		for _, pair := range pairs {
+			hash.Set(pair.Key.(Hashable), pair.Value)
+		}
+		return hash, nil
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		hash := NewHash(len(fields))
+		for _, f := range fields {
+			value, err := fromValue(v.Field(f.index), visiting)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(&String{Value: f.name}, value)
+		}
+		return hash, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromValue(v.Elem(), visiting)
+	case reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		fn, err := WrapFunc("function", v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return &Builtin{HostFn: fn}, nil
+	default:
+		return nil, fmt.Errorf("cannot convert Go %s to a Monkey object", v.Type())
+	}
+}
+
+// nillable reports whether values of kind k can be nil.
+func nillable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return true
+	default:
+		return false
+	}
+}
+
+// keyLess orders hash keys: by type first, then by value.
+func keyLess(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+}
+
+// ToGo stores obj in the value target points to, converting it to the
+// target's type. It is the inverse of FromGo. An interface{} target gets
+// int64, string, bool, nil, []interface{} or map[string]interface{}
+// (map[interface{}]interface{} when a hash has non-string keys).
+func ToGo(obj Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("ToGo target must be a non-nil pointer, got %T", target)
+	}
+	return toValue(obj, v.Elem())
+}
+
+func toValue(obj Object, v reflect.Value) error {
+	if obj == nil {
+		obj = NULL
+	}
+	t := v.Type()
+	if t.Kind() == reflect.Interface && t.NumMethod() > 0 {
+		if reflect.TypeOf(obj).AssignableTo(t) {
+			v.Set(reflect.ValueOf(obj))
+			return nil
+		}
+		return conversionError(obj, t)
+	}
+	if reflect.TypeOf(obj).AssignableTo(t) && t.Kind() != reflect.Interface {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		native, err := toNative(obj)
+		if err != nil {
+			return err
+		}
+		if native == nil {
+			v.Set(reflect.Zero(t))
+		} else {
+			v.Set(reflect.ValueOf(native))
+		}
+		return nil
+	case reflect.Ptr:
+		if obj.Type() == NULL_OBJ {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		elem := reflect.New(t.Elem())
+		if err := toValue(obj, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		v.SetBool(b.Value)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*Integer)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		if v.OverflowInt(i.Value) {
+			return fmt.Errorf("cannot convert %d to %s: out of range", i.Value, t)
+		}
+		v.SetInt(i.Value)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*Integer)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			return fmt.Errorf("cannot convert %d to %s: out of range", i.Value, t)
+		}
+		v.SetUint(uint64(i.Value))
+		return nil
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		v.SetString(s.Value)
+		return nil
+	case reflect.Slice:
+		if obj.Type() == NULL_OBJ {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		arr, ok := obj.(*Array)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		slice := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+		for i, el := range arr.Elements {
+			if err := toValue(el, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Array:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		if len(arr.Elements) != t.Len() {
+			return fmt.Errorf("cannot convert ARRAY of length %d to %s", len(arr.Elements), t)
+		}
+		for i, el := range arr.Elements {
+			if err := toValue(el, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if obj.Type() == NULL_OBJ {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		m := reflect.MakeMapWithSize(t, hash.Len())
+		for _, pair := range hash.Pairs() {
+			key := reflect.New(t.Key()).Elem()
+			if err := toValue(pair.Key, key); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := toValue(pair.Value, value); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Struct:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return conversionError(obj, t)
+		}
+		for _, f := range structFields(t) {
+			key := &String{Value: f.name}
+			value, ok := hash.Get(key)
+			if !ok {
+				continue
+			}
+			if err := toValue(value, v.Field(f.index)); err != nil {
+				return fmt.Errorf("field %s: %s", f.name, err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("cannot convert %s to Go %s", obj.Type(), t)
+	}
+}
+
+func toNative(obj Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Null:
+		return nil, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Integer:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			native, err := toNative(el)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = native
+		}
+		return elements, nil
+	case *Hash:
+		stringKeys := true
+		for _, pair := range obj.Pairs() {
+			if pair.Key.Type() != STRING_OBJ {
+				stringKeys = false
+			}
+		}
+		if stringKeys {
+			m := make(map[string]interface{}, obj.Len())
+			for _, pair := range obj.Pairs() {
+				value, err := toNative(pair.Value)
+				if err != nil {
+					return nil, err
+				}
+				m[pair.Key.(*String).Value] = value
+			}
+			return m, nil
+		}
+		m := make(map[interface{}]interface{}, obj.Len())
+		for _, pair := range obj.Pairs() {
+			key, err := toNative(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := toNative(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	default:
+		// functions and host values have no plain Go form.
+		return obj, nil
+	}
+}
+
+func conversionError(obj Object, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %s to Go %s", obj.Type(), t)
+}
+
+type structField struct {
+	index int
+	name  string
+}
+
+// structFields lists the exported fields of t with their Monkey names.
+func structFields(t reflect.Type) []structField {
+	fields := []structField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("monkey"); ok {
+			tag = strings.Split(tag, ",")[0]
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{index: i, name: name})
+	}
+	return fields
+}
+
+// WrapFunc turns fn, a Go function of any signature, into a HostFunction.
+// Arguments are converted with ToGo to fn's parameter types; calls with
+// the wrong number or types of arguments return an error object naming
+// the builtin as name. fn may take a context.Context as its first
+// parameter and may be variadic. It may return nothing, a value, an error,
+// or a value and an error; the value is converted with FromGo.
+func WrapFunc(name string, fn interface{}) (HostFunction, error) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func {
+		return nil, fmt.Errorf("cannot wrap %T as a builtin: not a function", fn)
+	}
+
+	takesContext := t.NumIn() > 0 && t.In(0) == contextType
+	first := 0
+	if takesContext {
+		first = 1
+	}
+
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	numValues := t.NumOut()
+	if returnsError {
+		numValues--
+	}
+	if numValues > 1 {
+		return nil, fmt.Errorf("cannot wrap %s as a builtin: too many results", t)
+	}
+
+	params := []reflect.Type{}
+	for i := first; i < t.NumIn(); i++ {
+		params = append(params, t.In(i))
+	}
+
+	return func(ctx context.Context, args ...Object) (Object, error) {
+		in := []reflect.Value{}
+		if takesContext {
+			in = append(in, reflect.ValueOf(&ctx).Elem())
+		}
+
+		if t.IsVariadic() {
+			if len(args) < len(params)-1 {
+				return newError("wrong number of arguments. got=%d, want at least %d",
+					len(args), len(params)-1), nil
+			}
+		} else if len(args) != len(params) {
+			return newError("wrong number of arguments. got=%d, want=%d",
+				len(args), len(params)), nil
+		}
+
+		for i, arg := range args {
+			var paramType reflect.Type
+			if t.IsVariadic() && i >= len(params)-1 {
+				paramType = params[len(params)-1].Elem()
+			} else {
+				paramType = params[i]
+			}
+			value := reflect.New(paramType).Elem()
+			if err := toValue(arg, value); err != nil {
+				return newError("argument %d to `%s` must be %s, got %s",
+					i+1, name, monkeyTypeName(paramType), arg.Type()), nil
+			}
+			in = append(in, value)
+		}
+
+		out := v.Call(in)
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return nil, err
+			}
+		}
+		if numValues == 0 {
+			return nil, nil
+		}
+		result, err := fromValue(out[0], map[visit]bool{})
+		if err != nil || out[0].Type().Implements(objectType) {
+			return result, err
+		}
+		// the result was converted, so it is a new object
+		return tracked(ctx, result)
+	}, nil
+}
+
+// monkeyTypeName names the Monkey type a Go parameter of type t accepts.
+func monkeyTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return BOOLEAN_OBJ
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return INTEGER_OBJ
+	case reflect.String:
+		return STRING_OBJ
+	case reflect.Slice, reflect.Array:
+		return ARRAY_OBJ
+	case reflect.Map, reflect.Struct:
+		return HASH_OBJ
+	case reflect.Ptr:
+		return monkeyTypeName(t.Elem())
+	default:
+		return t.String()
+	}
+}
@@ -0,0 +1,261 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type address struct {
+	City string `monkey:"city"`
+	Zip  int    `monkey:"zip"`
+}
+
+type person struct {
+	Name     string   `monkey:"name"`
+	Age      int      `monkey:"age"`
+	Tags     []string `monkey:"tags"`
+	Address  *address `monkey:"address"`
+	Password string   `monkey:"-"`
+	Nickname string
+	secret   string
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{"hi", "hi"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{map[string]int{"one": 1}, "{one: 1}"},
+		{map[string]int{"b": 2, "a": 1, "c": 3}, "{a: 1, b: 2, c: 3}"},
+		{map[int]bool{10: true, -1: false, 2: true}, "{-1: false, 2: true, 10: true}"},
+		{&Integer{Value: 5}, "5"},
+		{[]interface{}{1, "two", nil}, "[1, two, null]"},
+	}
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%v) failed: %s", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%v) wrong. want=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	if obj, _ := FromGo(false); obj != FALSE {
+		t.Errorf("false did not convert to FALSE")
+	}
+
+	obj, err := FromGo(person{Name: "Ann", Age: 30, Password: "x", secret: "y"})
+	if err != nil {
+		t.Fatalf("FromGo(struct) failed: %s", err)
+	}
+	hash := obj.(*Hash)
+	for _, key := range []string{"name", "age", "tags", "address", "Nickname"} {
+		if _, ok := hash.Get(&String{Value: key}); !ok {
+			t.Errorf("struct hash has no key %q", key)
+		}
+	}
+	if hash.Len() != 5 {
+		t.Errorf("struct hash has wrong number of pairs. got=%d", hash.Len())
+	}
+	keys := []string{}
+	for _, pair := range hash.Pairs() {
+		keys = append(keys, pair.Key.Inspect())
+	}
+	if strings.Join(keys, " ") != "name age tags address Nickname" {
+		t.Errorf("struct hash keys not in field order. got=%v", keys)
+	}
+
+	for _, input := range []interface{}{1.5, uint64(1 << 63), map[float64]int{1: 1}} {
+		if _, err := FromGo(input); err == nil {
+			t.Errorf("FromGo(%v) should fail", input)
+		}
+	}
+}
+
+// valueObject implements Object with value receivers.
+type valueObject struct{ name string }
+
+func (v valueObject) Type() ObjectType { return "VALUE" }
+func (v valueObject) Inspect() string  { return v.name }
+
+type node struct {
+	Next *node `monkey:"next"`
+}
+
+func TestFromGoReferences(t *testing.T) {
+	obj, err := FromGo([]valueObject{{"a"}, {"b"}})
+	if err != nil {
+		t.Fatalf("FromGo([]valueObject) failed: %s", err)
+	}
+	if obj.Inspect() != "[a, b]" {
+		t.Errorf("FromGo([]valueObject) wrong. got=%q", obj.Inspect())
+	}
+
+	// a value reached twice is not a cycle
+	shared := &address{City: "Oslo"}
+	obj, err = FromGo([]*address{shared, shared})
+	if err != nil {
+		t.Fatalf("FromGo(shared) failed: %s", err)
+	}
+	if obj.Inspect() != "[{city: Oslo, zip: 0}, {city: Oslo, zip: 0}]" {
+		t.Errorf("FromGo(shared) wrong. got=%q", obj.Inspect())
+	}
+
+	loop := &node{}
+	loop.Next = loop
+	self := []interface{}{nil}
+	self[0] = self
+	selfMap := map[string]interface{}{}
+	selfMap["self"] = selfMap
+	for _, input := range []interface{}{loop, self, selfMap} {
+		_, err := FromGo(input)
+		if err == nil || !strings.Contains(err.Error(), "contains itself") {
+			t.Errorf("FromGo(%T) wrong error. got=%v", input, err)
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	src := person{
+		Name:    "Ann",
+		Age:     30,
+		Tags:    []string{"a", "b"},
+		Address: &address{City: "Oslo", Zip: 150},
+	}
+	obj, err := FromGo(src)
+	if err != nil {
+		t.Fatalf("FromGo failed: %s", err)
+	}
+	var dst person
+	if err := ToGo(obj, &dst); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	if dst.Name != "Ann" || dst.Age != 30 || len(dst.Tags) != 2 || dst.Address == nil || dst.Address.City != "Oslo" {
+		t.Errorf("struct round trip wrong. got=%+v", dst)
+	}
+
+	var native interface{}
+	arr, _ := FromGo([]interface{}{1, "a", true, map[string]int{"k": 2}})
+	if err := ToGo(arr, &native); err != nil {
+		t.Fatalf("ToGo(interface{}) failed: %s", err)
+	}
+	elements := native.([]interface{})
+	if elements[0] != int64(1) || elements[1] != "a" || elements[2] != true {
+		t.Errorf("wrong native values. got=%#v", elements)
+	}
+	if elements[3].(map[string]interface{})["k"] != int64(2) {
+		t.Errorf("wrong native hash. got=%#v", elements[3])
+	}
+
+	var small int8
+	if err := ToGo(&Integer{Value: 300}, &small); err == nil {
+		t.Errorf("ToGo should fail on overflow")
+	}
+	var s string
+	if err := ToGo(&Integer{Value: 1}, &s); err == nil {
+		t.Errorf("ToGo should fail on type mismatch")
+	}
+	if err := ToGo(&Integer{Value: 1}, s); err == nil {
+		t.Errorf("ToGo should fail on non-pointer target")
+	}
+	var o Object
+	if err := ToGo(&Integer{Value: 1}, &o); err != nil || o.Inspect() != "1" {
+		t.Errorf("ToGo(Object) failed: %v", err)
+	}
+}
+
+func TestWrapFunc(t *testing.T) {
+	tests := []struct {
+		fn       interface{}
+		args     []Object
+		expected string
+		err      string
+	}{
+		{
+			fn:       func(a, b int) int { return a + b },
+			args:     []Object{&Integer{Value: 1}, &Integer{Value: 2}},
+			expected: "3",
+		},
+		{
+			fn:       func(a, b int) int { return a + b },
+			args:     []Object{&Integer{Value: 1}},
+			expected: "ERROR: wrong number of arguments. got=1, want=2",
+		},
+		{
+			fn:       func(s string, n int) string { return s },
+			args:     []Object{&Integer{Value: 1}, &Integer{Value: 2}},
+			expected: "ERROR: argument 1 to `f` must be STRING, got INTEGER",
+		},
+		{
+			fn: func(sep string, parts ...string) string {
+				out := ""
+				for i, p := range parts {
+					if i > 0 {
+						out += sep
+					}
+					out += p
+				}
+				return out
+			},
+			args:     []Object{&String{Value: "-"}, &String{Value: "a"}, &String{Value: "b"}},
+			expected: "a-b",
+		},
+		{
+			fn:       func(ctx context.Context, xs []int) (int, error) { return len(xs), nil },
+			args:     []Object{&Array{Elements: []Object{&Integer{Value: 1}}}},
+			expected: "1",
+		},
+		{
+			fn:   func() error { return errors.New("boom") },
+			err:  "boom",
+			args: []Object{},
+		},
+		{
+			fn:       func() {},
+			args:     []Object{},
+			expected: "<nil>",
+		},
+	}
+	for _, tt := range tests {
+		hostFn, err := WrapFunc("f", tt.fn)
+		if err != nil {
+			t.Fatalf("WrapFunc failed: %s", err)
+		}
+		result, err := hostFn(context.Background(), tt.args...)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("wrong error. want=%q, got=%v", tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+			continue
+		}
+		got := "<nil>"
+		if result != nil {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result. want=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	if _, err := WrapFunc("f", 5); err == nil {
+		t.Errorf("WrapFunc should reject non-functions")
+	}
+	if _, err := WrapFunc("f", func() (int, int) { return 1, 2 }); err == nil {
+		t.Errorf("WrapFunc should reject two results")
+	}
+}
@@ -1,8 +1,15 @@
 package object
 
+import (
+	"context"
+	"sort"
+)
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.run = outer.run
+	env.builtins = outer.builtins
 	return env
 }
 
@@ -11,9 +18,61 @@ func NewEnvironment() *Environment {
 	return &Environment{store: s, outer: nil}
 }
 
+// NewCallEnvironment creates the environment for a single function call.
+// Names resolve through outer, the environment the function was defined in,
+// while the call depth continues from caller.
+func NewCallEnvironment(outer, caller *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.depth = caller.depth + 1
+	env.run = caller.run
+	return env
+}
+
+// NewEnvironmentWithContext creates a top-level environment whose
+// evaluation stops once ctx is done or more than maxSteps steps were
+// taken. A maxSteps of 0 means no step limit.
+func NewEnvironmentWithContext(ctx context.Context, maxSteps int64) *Environment {
+	env := NewEnvironment()
+	env.run = &runState{ctx: ctx, maxSteps: maxSteps}
+	return env
+}
+
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store    map[string]Object
+	outer    *Environment
+	depth    int // number of active function calls
+	run      *runState
+	builtins *Registry
+}
+
+// SetBuiltins makes the builtins of r visible in e and in every environment
+// enclosed by it.
+func (e *Environment) SetBuiltins(r *Registry) {
+	e.builtins = r
+}
+
+func (e *Environment) Builtin(name string) (*Builtin, bool) {
+	return e.builtins.Lookup(name)
+}
+
+func (e *Environment) Depth() int {
+	return e.depth
+}
+
+func (e *Environment) Context() context.Context {
+	if e.run == nil {
+		return context.Background()
+	}
+	return e.run.ctx
+}
+
+// Step counts one evaluation step against the environment's budget and
+// reports ErrBudgetExceeded or the context's error once evaluation must stop.
+func (e *Environment) Step() error {
+	if e.run == nil {
+		return nil
+	}
+	return e.run.step()
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -28,3 +87,19 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Delete removes the binding of name from e itself.
+func (e *Environment) Delete(name string) {
+	delete(e.store, name)
+}
+
+// Names returns the sorted names bound in e itself, not in its outer
+// environments.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
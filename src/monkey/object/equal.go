@@ -0,0 +1,90 @@
+package object
+
+// Equal reports whether a and b are equal values. Integers, booleans and
+// strings are equal when their values are, null equals null, arrays are
+// equal when their elements are pairwise equal and hashes when they hold
+// equal values for the same keys, in any order. All other objects, such
+// as functions, are only equal to themselves.
+//
+// Arrays and hashes that contain themselves are compared without looping:
+// a pair of objects already being compared further up is taken to be equal.
+func Equal(a, b Object) bool {
+	e := equality{}
+	return e.equal(a, b)
+}
+
+type equality struct {
+	// comparing holds the arrays and hashes being compared further up.
+	comparing map[[2]Object]bool
+}
+
+func (e *equality) equal(a, b Object) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil || a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Null:
+		return true
+	case *Array:
+		b := b.(*Array)
+		if len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		if !e.enter(a, b) {
+			return true
+		}
+		defer e.leave(a, b)
+		for i, el := range a.Elements {
+			if !e.equal(el, b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b := b.(*Hash)
+		if a.Len() != b.Len() {
+			return false
+		}
+		if !e.enter(a, b) {
+			return true
+		}
+		defer e.leave(a, b)
+		for _, pair := range a.Pairs() {
+			value, ok := b.Get(pair.Key.(Hashable))
+			if !ok || !e.equal(pair.Value, value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// enter records that a and b are being compared. It returns false if they
+// already are.
+func (e *equality) enter(a, b Object) bool {
+	key := [2]Object{a, b}
+	if e.comparing[key] {
+		return false
+	}
+	if e.comparing == nil {
+		e.comparing = make(map[[2]Object]bool)
+	}
+	e.comparing[key] = true
+	return true
+}
+
+func (e *equality) leave(a, b Object) {
+	delete(e.comparing, [2]Object{a, b})
+}
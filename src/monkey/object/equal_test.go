@@ -0,0 +1,68 @@
+package object
+
+import "testing"
+
+func TestEqual(t *testing.T) {
+	hash := func(pairs ...Object) *Hash {
+		h := &Hash{}
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i].(Hashable), pairs[i+1])
+		}
+		return h
+	}
+	array := func(elements ...Object) *Array { return &Array{Elements: elements} }
+	str := func(s string) *String { return &String{Value: s} }
+	integer := func(i int64) *Integer { return &Integer{Value: i} }
+	fn := &Builtin{}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{integer(1), integer(1), true},
+		{integer(1), integer(2), false},
+		{str("a"), str("a"), true},
+		{str("a"), integer(1), false},
+		{NULL, &Null{}, true},
+		{TRUE, &Boolean{Value: true}, true},
+		{array(integer(1), array(str("x"))), array(integer(1), array(str("x"))), true},
+		{array(integer(1)), array(integer(1), integer(2)), false},
+		{array(NULL), array(FALSE), false},
+		{hash(str("a"), integer(1), str("b"), integer(2)), hash(str("b"), integer(2), str("a"), integer(1)), true},
+		{hash(str("a"), integer(1)), hash(str("a"), integer(2)), false},
+		{hash(str("a"), integer(1)), hash(str("b"), integer(1)), false},
+		{fn, fn, true},
+		{fn, &Builtin{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Equal(%s, %s) wrong. want=%t, got=%t", tt.a.Inspect(), tt.b.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestEqualCycles(t *testing.T) {
+	// a = [1, a] and b = [1, b] unfold to the same infinite array
+	a := &Array{Elements: []Object{&Integer{Value: 1}}}
+	a.Elements = append(a.Elements, a)
+	b := &Array{Elements: []Object{&Integer{Value: 1}}}
+	b.Elements = append(b.Elements, b)
+	if !Equal(a, b) {
+		t.Errorf("cyclic arrays are not equal")
+	}
+
+	c := &Array{Elements: []Object{&Integer{Value: 2}}}
+	c.Elements = append(c.Elements, c)
+	if Equal(a, c) {
+		t.Errorf("different cyclic arrays are equal")
+	}
+
+	h := &Hash{}
+	h.Set(&String{Value: "self"}, h)
+	g := &Hash{}
+	g.Set(&String{Value: "self"}, g)
+	if !Equal(h, g) {
+		t.Errorf("cyclic hashes are not equal")
+	}
+}
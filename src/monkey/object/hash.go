@@ -0,0 +1,152 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps keys to values and remembers the order the keys were added
+// in. Pairs, Inspect and the hash methods all follow that order. Lookup,
+// Set and Delete take constant time. The zero Hash is empty and ready to
+// use.
+//
+// Keys are told apart with Equal, so different keys with the same HashKey
+// do not overwrite each other. An array or hash used as a key must not be
+// changed afterwards.
+type Hash struct {
+	// pairs holds the pairs in insertion order. Deleting a pair leaves a
+	// hole with a nil Key, which compact removes once holes make up half
+	// of pairs.
+	pairs []HashPair
+	// index maps the HashKey of every key in the hash to the positions in
+	// pairs of the keys with that HashKey, usually just one.
+	index map[HashKey][]int
+	// size is the number of pairs in the hash.
+	size int
+}
+
+// NewHash returns an empty hash with room for size pairs.
+func NewHash(size int) *Hash {
+	return &Hash{
+		pairs: make([]HashPair, 0, size),
+		index: make(map[HashKey][]int, size),
+	}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.Pairs() {
+		pairs = append(pairs, fmt.Sprintf("%s: %s",
+			pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Len returns the number of pairs in h.
+func (h *Hash) Len() int { return h.size }
+
+// Get returns the value bound to key.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	i, ok := h.find(key.HashKey(), key)
+	if !ok {
+		return nil, false
+	}
+	return h.pairs[i].Value, true
+}
+
+// Set binds key to value. A new key goes after all keys already in h; a
+// key that is already there keeps its place.
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if i, ok := h.find(hashKey, key); ok {
+		h.pairs[i] = HashPair{Key: key, Value: value}
+		return
+	}
+	if h.index == nil {
+		h.index = make(map[HashKey][]int)
+	}
+	h.index[hashKey] = append(h.index[hashKey], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+	h.size++
+}
+
+// Delete removes key from h and reports whether it was there.
+func (h *Hash) Delete(key Hashable) bool {
+	hashKey := key.HashKey()
+	i, ok := h.find(hashKey, key)
+	if !ok {
+		return false
+	}
+	h.unindex(hashKey, i)
+	h.pairs[i] = HashPair{}
+	h.size--
+	if holes := len(h.pairs) - h.size; holes > len(h.pairs)/2 {
+		h.compact()
+	}
+	return true
+}
+
+// find returns the position in h.pairs of key, whose HashKey is hashKey.
+func (h *Hash) find(hashKey HashKey, key Object) (int, bool) {
+	for _, i := range h.index[hashKey] {
+		if Equal(h.pairs[i].Key, key) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// unindex removes position i from the bucket of hashKey.
+func (h *Hash) unindex(hashKey HashKey, i int) {
+	bucket := h.index[hashKey]
+	if len(bucket) == 1 {
+		delete(h.index, hashKey)
+		return
+	}
+	for j, position := range bucket {
+		if position == i {
+			h.index[hashKey] = append(bucket[:j:j], bucket[j+1:]...)
+			return
+		}
+	}
+}
+
+// compact removes the holes Delete leaves in h.pairs.
+func (h *Hash) compact() {
+	pairs := make([]HashPair, 0, h.size)
+	index := make(map[HashKey][]int, len(h.index))
+	for _, pair := range h.pairs {
+		if pair.Key != nil {
+			hashKey := pair.Key.(Hashable).HashKey()
+			index[hashKey] = append(index[hashKey], len(pairs))
+			pairs = append(pairs, pair)
+		}
+	}
+	h.pairs, h.index = pairs, index
+}
+
+// Pairs returns the pairs of h in insertion order. The slice is a copy and
+// may be modified.
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, h.size)
+	for _, pair := range h.pairs {
+		if pair.Key != nil {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
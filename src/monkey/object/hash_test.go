@@ -0,0 +1,142 @@
+package object
+
+import "testing"
+
+func TestHashOrder(t *testing.T) {
+	hash := &Hash{}
+	for _, key := range []string{"c", "a", "b"} {
+		hash.Set(&String{Value: key}, &Integer{Value: int64(len(key))})
+	}
+	hash.Set(&String{Value: "a"}, &Integer{Value: 2})
+
+	if hash.Inspect() != "{c: 1, a: 2, b: 1}" {
+		t.Errorf("Inspect wrong. got=%q", hash.Inspect())
+	}
+	value, ok := hash.Get(&String{Value: "a"})
+	if !ok || value.Inspect() != "2" {
+		t.Errorf("Get(a) wrong. got=%v, %t", value, ok)
+	}
+	if _, ok := hash.Get(&String{Value: "d"}); ok {
+		t.Errorf("Get(d) found a value")
+	}
+}
+
+func TestHashDelete(t *testing.T) {
+	hash := NewHash(0)
+	for i := int64(0); i < 10; i++ {
+		hash.Set(&Integer{Value: i}, TRUE)
+	}
+	for i := int64(0); i < 10; i += 2 {
+		if !hash.Delete(&Integer{Value: i}) {
+			t.Errorf("Delete(%d) did not find the key", i)
+		}
+	}
+	if hash.Delete(&Integer{Value: 0}) {
+		t.Errorf("Delete(0) found a deleted key")
+	}
+	hash.Set(&Integer{Value: 0}, FALSE)
+
+	if hash.Len() != 6 {
+		t.Errorf("Len wrong. want=6, got=%d", hash.Len())
+	}
+	expected := "{1: true, 3: true, 5: true, 7: true, 9: true, 0: false}"
+	if hash.Inspect() != expected {
+		t.Errorf("Inspect wrong.\nwant=%q\ngot= %q", expected, hash.Inspect())
+	}
+	for _, i := range []int64{1, 9, 0} {
+		if _, ok := hash.Get(&Integer{Value: i}); !ok {
+			t.Errorf("Get(%d) lost the key", i)
+		}
+	}
+	if len(hash.pairs) > 2*hash.Len() {
+		t.Errorf("deleted pairs not compacted. len(pairs)=%d", len(hash.pairs))
+	}
+}
+
+// collider is a key type whose values all share one HashKey.
+type collider struct{ name string }
+
+func (c *collider) Type() ObjectType { return "COLLIDER" }
+func (c *collider) Inspect() string  { return c.name }
+func (c *collider) HashKey() HashKey { return HashKey{Type: "COLLIDER"} }
+
+func TestHashCollisions(t *testing.T) {
+	a, b, c := &collider{"a"}, &collider{"b"}, &collider{"c"}
+	hash := &Hash{}
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(b, &Integer{Value: 2})
+	hash.Set(c, &Integer{Value: 3})
+
+	if hash.Inspect() != "{a: 1, b: 2, c: 3}" {
+		t.Errorf("colliding keys overwrote each other. got=%q", hash.Inspect())
+	}
+	if !hash.Delete(b) {
+		t.Errorf("Delete(b) did not find the key")
+	}
+	for _, key := range []*collider{a, c} {
+		if _, ok := hash.Get(key); !ok {
+			t.Errorf("Get(%s) lost the key", key.name)
+		}
+	}
+	if _, ok := hash.Get(b); ok {
+		t.Errorf("Get(b) found a deleted key")
+	}
+}
+
+func TestStructuralHashKey(t *testing.T) {
+	array := func(elements ...Object) *Array { return &Array{Elements: elements} }
+	one, two := &Integer{Value: 1}, &String{Value: "two"}
+
+	if array(one, two).HashKey() != array(&Integer{Value: 1}, &String{Value: "two"}).HashKey() {
+		t.Errorf("equal arrays have different hash keys")
+	}
+	if array(one, two).HashKey() == array(two, one).HashKey() {
+		t.Errorf("arrays in different order have the same hash key")
+	}
+	if array(one).HashKey() == array(array(one)).HashKey() {
+		t.Errorf("nested array has the same hash key")
+	}
+
+	h1, h2 := &Hash{}, &Hash{}
+	h1.Set(one, two)
+	h1.Set(two, array(one))
+	h2.Set(two, array(one))
+	h2.Set(one, two)
+	if h1.HashKey() != h2.HashKey() {
+		t.Errorf("equal hashes have different hash keys")
+	}
+	h2.Set(one, one)
+	if h1.HashKey() == h2.HashKey() {
+		t.Errorf("different hashes have the same hash key")
+	}
+}
+
+func TestAsHashable(t *testing.T) {
+	cyclic := &Array{}
+	cyclic.Elements = []Object{cyclic}
+	shared := &Array{Elements: []Object{TRUE}}
+	withFunction := &Hash{}
+	withFunction.Set(&String{Value: "f"}, &Builtin{})
+
+	tests := []struct {
+		input    Object
+		expected bool
+	}{
+		{&String{Value: "a"}, true},
+		{&Builtin{}, false},
+		{&Array{Elements: []Object{&Integer{Value: 1}, &Array{}}}, true},
+		{&Array{Elements: []Object{shared, shared}}, true},
+		{&Array{Elements: []Object{NULL}}, false},
+		{withFunction, false},
+		{cyclic, false},
+	}
+
+	for _, tt := range tests {
+		_, ok := AsHashable(tt.input)
+		if ok != tt.expected {
+			t.Errorf("AsHashable(%T) wrong. want=%t, got=%t", tt.input, tt.expected, ok)
+		}
+	}
+	// HashKey must not loop even on keys AsHashable rejects
+	cyclic.HashKey()
+}
@@ -0,0 +1,119 @@
+package object
+
+import "hash/fnv"
+
+// AsHashable returns obj as a Hashable if it can be used as a hash key.
+// Integers, booleans and strings can. Arrays and hashes can when all the
+// objects in them can and they do not contain themselves.
+func AsHashable(obj Object) (Hashable, bool) {
+	h, ok := obj.(Hashable)
+	if !ok || !usableKey(obj, map[Object]bool{}) {
+		return nil, false
+	}
+	return h, true
+}
+
+// usableKey reports whether obj and everything in it is Hashable.
+// visiting holds the arrays and hashes obj is inside of.
+func usableKey(obj Object, visiting map[Object]bool) bool {
+	switch obj := obj.(type) {
+	case *Array:
+		if visiting[obj] {
+			return false
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		for _, el := range obj.Elements {
+			if !usableKey(el, visiting) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		if visiting[obj] {
+			return false
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		for _, pair := range obj.pairs {
+			if pair.Key != nil && !usableKey(pair.Value, visiting) {
+				return false
+			}
+		}
+		return true
+	default:
+		_, ok := obj.(Hashable)
+		return ok
+	}
+}
+
+// HashKey combines the hash keys of the elements, so equal arrays have
+// equal keys.
+func (ao *Array) HashKey() HashKey {
+	return structuralKey(ao, map[Object]bool{})
+}
+
+// HashKey combines the hash keys of the pairs independent of their order,
+// so equal hashes have equal keys.
+func (h *Hash) HashKey() HashKey {
+	return structuralKey(h, map[Object]bool{})
+}
+
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+// structuralKey returns the hash key of obj. Objects that are not
+// Hashable only contribute their type, and so do arrays and hashes met
+// again inside themselves, which keeps HashKey from looping even on
+// objects AsHashable rejects.
+func structuralKey(obj Object, visiting map[Object]bool) HashKey {
+	switch obj := obj.(type) {
+	case *Array:
+		if visiting[obj] {
+			return HashKey{Type: obj.Type()}
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		value := uint64(fnvOffset)
+		for _, el := range obj.Elements {
+			value = mixKey(value, structuralKey(el, visiting))
+		}
+		return HashKey{Type: obj.Type(), Value: value}
+	case *Hash:
+		if visiting[obj] {
+			return HashKey{Type: obj.Type()}
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		// summing makes the order of the pairs irrelevant
+		var value uint64
+		for _, pair := range obj.pairs {
+			if pair.Key != nil {
+				key := mixKey(fnvOffset, structuralKey(pair.Key, visiting))
+				value += mixKey(key, structuralKey(pair.Value, visiting))
+			}
+		}
+		return HashKey{Type: obj.Type(), Value: value}
+	case Hashable:
+		return obj.HashKey()
+	default:
+		return HashKey{Type: obj.Type()}
+	}
+}
+
+// mixKey folds key into the running hash value.
+func mixKey(value uint64, key HashKey) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key.Type))
+	value = (value ^ h.Sum64()) * fnvPrime
+	for i := 0; i < 64; i += 8 {
+		value = (value ^ (key.Value>>i)&0xff) * fnvPrime
+	}
+	return value
+}
@@ -0,0 +1,51 @@
+package object
+
+import (
+	"context"
+	"fmt"
+)
+
+// HostObject is a value backed by the Go program embedding Monkey, like a
+// database row or a request. Scripts reach into it with member access
+// (obj.name), method calls (obj.name(args)) and the index operator
+// (obj[key]) instead of converting the whole value up front.
+//
+// A non-nil error aborts the script with that error.
+type HostObject interface {
+	Object
+	GetAttr(name string) (Object, error)
+	SetAttr(name string, value Object) error
+	CallMethod(ctx context.Context, name string, args ...Object) (Object, error)
+	Index(key Object) (Object, error)
+}
+
+// IsHostObject reports whether obj is a HostObject.
+func IsHostObject(obj Object) bool {
+	_, ok := obj.(HostObject)
+	return ok
+}
+
+// GetAttr returns the attribute name of obj. The attributes of built-in
+// types are their methods.
+func GetAttr(obj Object, name string) (Object, error) {
+	if host, ok := obj.(HostObject); ok {
+		return host.GetAttr(name)
+	}
+	if method, ok := LookupMethod(obj.Type(), name); ok {
+		return bindMethod(method, obj), nil
+	}
+	return nil, fmt.Errorf("%s has no attribute %s", obj.Type(), name)
+}
+
+// CallMethod calls the method name of obj, either a host object's or one
+// from the method table of its built-in type. ctx is passed on to host
+// objects so they can call back into the script.
+func CallMethod(ctx context.Context, obj Object, name string, args ...Object) (Object, error) {
+	if host, ok := obj.(HostObject); ok {
+		return host.CallMethod(ctx, name, args...)
+	}
+	if method, ok := LookupMethod(obj.Type(), name); ok {
+		return method(ctx, obj, args...)
+	}
+	return nil, fmt.Errorf("%s has no method %s", obj.Type(), name)
+}
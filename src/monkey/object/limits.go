@@ -0,0 +1,88 @@
+package object
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrBudgetExceeded is reported when a script runs more steps than its
+// budget allows.
+var ErrBudgetExceeded = errors.New("instruction budget exceeded")
+
+// ErrMemoryLimit is reported when a script allocates more memory than
+// allowed.
+var ErrMemoryLimit = errors.New("memory limit exceeded")
+
+// Rough sizes in bytes of what the Go runtime allocates for the objects
+// below; close enough to bound a script, not exact.
+const (
+	headerSize   = 16 // the struct behind an Object
+	elementSize  = 16 // an interface value in a slice
+	hashPairSize = 56 // HashPair plus its index entry
+)
+
+// AllocSize returns the approximate number of bytes allocated for obj
+// itself, not counting the objects it refers to, since those are
+// accounted when they are created. Only arrays, hashes and strings can
+// grow without bound, so everything else counts as 0.
+func AllocSize(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *String:
+		return headerSize + int64(len(obj.Value))
+	case *Array:
+		return headerSize + elementSize*int64(len(obj.Elements))
+	case *Hash:
+		return headerSize + hashPairSize*int64(obj.Len())
+	default:
+		return 0
+	}
+}
+
+// Tracker counts the objects a script creates against a memory limit.
+type Tracker interface {
+	Track(obj Object) error
+}
+
+type trackerKey struct{}
+
+// WithTracker returns a context carrying t. Engines with a memory limit use
+// it for the context they hand to host functions.
+func WithTracker(ctx context.Context, t Tracker) context.Context {
+	return context.WithValue(ctx, trackerKey{}, t)
+}
+
+// Track reports obj, newly created by a host function, to the Tracker in
+// ctx. Objects a host function passes on without creating them, like an
+// element of an argument, must not be reported. Track returns
+// ErrMemoryLimit once the limit is exceeded and does nothing if ctx has no
+// Tracker.
+func Track(ctx context.Context, obj Object) error {
+	t, ok := ctx.Value(trackerKey{}).(Tracker)
+	if !ok {
+		return nil
+	}
+	return t.Track(obj)
+}
+
+// CtxCheckInterval is how many steps the evaluator, or instructions the
+// VM, run between checks of the context, since looking at ctx.Err on
+// every step is comparatively expensive.
+const CtxCheckInterval = 1024
+
+// runState is shared by every environment of a single evaluation.
+type runState struct {
+	ctx      context.Context
+	maxSteps int64
+	steps    int64
+}
+
+func (r *runState) step() error {
+	r.steps++
+	if r.maxSteps > 0 && r.steps > r.maxSteps {
+		return ErrBudgetExceeded
+	}
+	if r.steps%CtxCheckInterval == 0 {
+		return r.ctx.Err()
+	}
+	return nil
+}
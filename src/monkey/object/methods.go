@@ -0,0 +1,167 @@
+package object
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Method is a method of a built-in type. receiver is the value the method
+// is called on and args are the arguments inside the parentheses.
+type Method func(ctx context.Context, receiver Object, args ...Object) (Object, error)
+
+// methods holds the methods of the built-in types, e.g. "abc".upper() or
+// arr.push(1). The tables are fixed; hosts extend scripts with builtins
+// and host objects instead.
+var methods = map[ObjectType]map[string]Method{
+	STRING_OBJ: {
+		"len": builtinMethod("len", 0, 0),
+		"upper": stringMethod("upper", 0, func(s string, args []Object) Object {
+			return &String{Value: strings.ToUpper(s)}
+		}),
+		"lower": stringMethod("lower", 0, func(s string, args []Object) Object {
+			return &String{Value: strings.ToLower(s)}
+		}),
+		"trim": stringMethod("trim", 0, func(s string, args []Object) Object {
+			return &String{Value: strings.TrimSpace(s)}
+		}),
+		"split": stringMethod("split", 1, func(s string, args []Object) Object {
+			parts := strings.Split(s, args[0].(*String).Value)
+			elements := make([]Object, len(parts))
+			for i, part := range parts {
+				elements[i] = &String{Value: part}
+			}
+			return &Array{Elements: elements}
+		}),
+		"contains": stringMethod("contains", 1, func(s string, args []Object) Object {
+			return nativeBoolToBoolean(strings.Contains(s, args[0].(*String).Value))
+		}),
+	},
+	ARRAY_OBJ: {
+		"len":    builtinMethod("len", 0, 0),
+		"first":  builtinMethod("first", 0, 0),
+		"last":   builtinMethod("last", 0, 0),
+		"rest":   builtinMethod("rest", 0, 0),
+		"push":   builtinMethod("push", 1, 1),
+		"map":    builtinMethod("map", 1, 1),
+		"reduce": builtinMethod("reduce", 2, 2),
+		"sort":   builtinMethod("sort", 0, 1),
+		"join": func(ctx context.Context, receiver Object, args ...Object) (Object, error) {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args)), nil
+			}
+			sep, ok := args[0].(*String)
+			if !ok {
+				return newError("argument to `join` must be STRING, got %s", args[0].Type()), nil
+			}
+			elements := receiver.(*Array).Elements
+			parts := make([]string, len(elements))
+			for i, el := range elements {
+				parts[i] = el.Inspect()
+			}
+			return tracked(ctx, &String{Value: strings.Join(parts, sep.Value)})
+		},
+	},
+	HASH_OBJ: {
+		"len": func(ctx context.Context, receiver Object, args ...Object) (Object, error) {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args)), nil
+			}
+			return &Integer{Value: int64(receiver.(*Hash).Len())}, nil
+		},
+		"keys": func(ctx context.Context, receiver Object, args ...Object) (Object, error) {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args)), nil
+			}
+			keys := []Object{}
+			for _, pair := range receiver.(*Hash).Pairs() {
+				keys = append(keys, pair.Key)
+			}
+			return tracked(ctx, &Array{Elements: keys})
+		},
+		"values": func(ctx context.Context, receiver Object, args ...Object) (Object, error) {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args)), nil
+			}
+			values := []Object{}
+			for _, pair := range receiver.(*Hash).Pairs() {
+				values = append(values, pair.Value)
+			}
+			return tracked(ctx, &Array{Elements: values})
+		},
+		"has": func(ctx context.Context, receiver Object, args ...Object) (Object, error) {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args)), nil
+			}
+			key, ok := AsHashable(args[0])
+			if !ok {
+				return newError("unusable as hash key: %s", args[0].Type()), nil
+			}
+			_, ok = receiver.(*Hash).Get(key)
+			return nativeBoolToBoolean(ok), nil
+		},
+	},
+}
+
+// LookupMethod returns the method name of the built-in type t.
+func LookupMethod(t ObjectType, name string) (Method, bool) {
+	method, ok := methods[t][name]
+	return method, ok
+}
+
+// MethodNames returns the sorted method names of the built-in type t.
+func MethodNames(t ObjectType) []string {
+	names := make([]string, 0, len(methods[t]))
+	for name := range methods[t] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bindMethod returns method bound to receiver as a callable builtin. Only
+// plain member access like s.upper needs it; s.upper() calls the method
+// directly.
+func bindMethod(method Method, receiver Object) *Builtin {
+	return &Builtin{HostFn: func(ctx context.Context, args ...Object) (Object, error) {
+		return method(ctx, receiver, args...)
+	}}
+}
+
+// builtinMethod adapts the builtin name into a method that passes the
+// receiver as the first argument and takes between min and max more.
+func builtinMethod(name string, min, max int) Method {
+	builtin := GetBuiltinByName(name)
+	return func(ctx context.Context, receiver Object, args ...Object) (Object, error) {
+		if len(args) < min || len(args) > max {
+			if min == max {
+				return newError("wrong number of arguments. got=%d, want=%d", len(args), min), nil
+			}
+			return newError("wrong number of arguments. got=%d, want=%d or %d", len(args), min, max), nil
+		}
+		return builtin.Call(ctx, append([]Object{receiver}, args...)...)
+	}
+}
+
+// stringMethod wraps fn, a method of STRING taking n STRING arguments and
+// returning a new object.
+func stringMethod(name string, n int, fn func(s string, args []Object) Object) Method {
+	return func(ctx context.Context, receiver Object, args ...Object) (Object, error) {
+		if len(args) != n {
+			return newError("wrong number of arguments. got=%d, want=%d", len(args), n), nil
+		}
+		for _, arg := range args {
+			if arg.Type() != STRING_OBJ {
+				return newError("argument to `%s` must be STRING, got %s", name, arg.Type()), nil
+			}
+		}
+		return tracked(ctx, fn(receiver.(*String).Value, args))
+	}
+}
+
+func nativeBoolToBoolean(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
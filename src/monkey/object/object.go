@@ -2,6 +2,7 @@ package object
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"hash/fnv"
 	"monkey/ast"
@@ -34,6 +35,27 @@ const (
 	CLOSURE_OBJ = "CLOSURE"
 )
 
+// The engines share one null and one true and false value, so objects
+// crossing between them and the host compare as expected.
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// IsTruthy reports whether obj counts as true in a condition. Only false
+// and null do not; everything else, even the integer 0, does.
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
 type Closure struct {
 	Fn   *CompiledFunction
 	Free []Object
@@ -46,12 +68,13 @@ func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
 
-
-
 type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	// Name is the name the function was bound to with let, empty for anonymous functions.
+	Name  string
+	Lines code.LineTable
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -62,7 +85,11 @@ type HashKey struct {
 	Value uint64
 }
 
+// Hashable is implemented by the objects that can be used as hash keys.
+// Arrays and hashes implement it but are only usable when their contents
+// are; AsHashable checks that.
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
 
@@ -113,11 +140,19 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
 type Error struct {
 	Message string
+	// Err is the Go error behind failures the host needs to tell apart,
+	// such as ErrBudgetExceeded. It is nil for ordinary script errors.
+	Err error
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
+// Error and Unwrap let engines and hosts pass an error object on as a Go
+// error, e.g. to fail a script when a builtin returns one.
+func (e *Error) Error() string { return e.Message }
+func (e *Error) Unwrap() error { return e.Err }
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
@@ -158,6 +193,15 @@ func (s *String) HashKey() HashKey {
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// HostFn is used instead of Fn for builtins registered by the host.
+	HostFn HostFunction
+}
+
+func (b *Builtin) Call(ctx context.Context, args ...Object) (Object, error) {
+	if b.HostFn != nil {
+		return b.HostFn(ctx, args...)
+	}
+	return b.Fn(args...), nil
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -182,29 +226,3 @@ func (ao *Array) Inspect() string {
 
 	return out.String()
 }
-
-type HashPair struct {
-	Key   Object
-	Value Object
-}
-
-type Hash struct {
-	Pairs map[HashKey]HashPair
-}
-
-func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
-
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(), pair.Value.Inspect()))
-	}
-
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
-
-	return out.String()
-}
@@ -58,3 +58,21 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestAllocSize(t *testing.T) {
+	small := &String{Value: "ab"}
+	large := &String{Value: "abcdefghijklmnopqrstuvwxyz"}
+	if AllocSize(large) <= AllocSize(small) {
+		t.Errorf("longer string is not larger. %d <= %d", AllocSize(large), AllocSize(small))
+	}
+
+	arr1 := &Array{Elements: []Object{small}}
+	arr2 := &Array{Elements: []Object{small, large}}
+	if AllocSize(arr2) <= AllocSize(arr1) {
+		t.Errorf("longer array is not larger. %d <= %d", AllocSize(arr2), AllocSize(arr1))
+	}
+
+	if AllocSize(&Integer{Value: 1}) != 0 {
+		t.Errorf("integers should not be accounted")
+	}
+}
@@ -0,0 +1,92 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// HostFunction is a builtin implemented by the Go program embedding Monkey.
+// ctx is the context the script runs under. A non-nil error aborts the
+// script with that error. Objects it creates count against the memory
+// limit of the script when it reports them with Track.
+type HostFunction func(ctx context.Context, args ...Object) (Object, error)
+
+// Registry maps names to builtins. The compiler, the VM and the evaluator
+// all resolve builtins through a Registry, so a host can hand the same one
+// to each of them.
+type Registry struct {
+	names    []string
+	builtins map[string]*Builtin
+}
+
+// defaultRegistry is what a nil Registry looks builtins up in.
+var defaultRegistry = NewRegistry()
+
+// NewRegistry returns a registry holding the default Builtins.
+func NewRegistry() *Registry {
+	r := &Registry{builtins: make(map[string]*Builtin)}
+	for _, def := range Builtins {
+		r.RegisterBuiltin(def.Name, def.Builtin)
+	}
+	return r
+}
+
+// Register adds fn under name. Names may be namespaced with dots, like
+// "http.get". Registering an existing name replaces its builtin.
+func (r *Registry) Register(name string, fn HostFunction) error {
+	return r.RegisterBuiltin(name, &Builtin{HostFn: fn})
+}
+
+// RegisterFunc adds fn, a Go function of any signature, under name.
+// Arguments and results are converted as described by WrapFunc.
+func (r *Registry) RegisterFunc(name string, fn interface{}) error {
+	hostFn, err := WrapFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	return r.Register(name, hostFn)
+}
+
+func (r *Registry) RegisterBuiltin(name string, builtin *Builtin) error {
+	if !isBuiltinName(name) {
+		return fmt.Errorf("invalid builtin name %q", name)
+	}
+	if _, ok := r.builtins[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.builtins[name] = builtin
+	return nil
+}
+
+// Lookup returns the builtin registered under name. A nil Registry holds
+// the default Builtins.
+func (r *Registry) Lookup(name string) (*Builtin, bool) {
+	if r == nil {
+		return defaultRegistry.Lookup(name)
+	}
+	builtin, ok := r.builtins[name]
+	return builtin, ok
+}
+
+// Names returns the registered names in registration order.
+func (r *Registry) Names() []string {
+	names := make([]string, len(r.names))
+	copy(names, r.names)
+	return names
+}
+
+// isBuiltinName reports whether name is one or more identifiers joined by dots.
+func isBuiltinName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if part == "" {
+			return false
+		}
+		for _, ch := range part {
+			if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
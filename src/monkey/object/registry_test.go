@@ -0,0 +1,46 @@
+package object
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if len(r.Names()) != len(Builtins) {
+		t.Fatalf("wrong number of default builtins. want=%d, got=%d", len(Builtins), len(r.Names()))
+	}
+
+	hostFn := func(ctx context.Context, args ...Object) (Object, error) {
+		return &Integer{Value: int64(len(args))}, nil
+	}
+	for _, name := range []string{"count", "http.get", "a.b_c.d"} {
+		if err := r.Register(name, hostFn); err != nil {
+			t.Errorf("Register(%q) failed: %s", name, err)
+		}
+	}
+	for _, name := range []string{"", "1abc", "http.", ".get", "a-b", "a..b"} {
+		if err := r.Register(name, hostFn); err == nil {
+			t.Errorf("Register(%q) should fail", name)
+		}
+	}
+
+	// replacing keeps the original position.
+	r.Register("len", hostFn)
+	names := r.Names()
+	if names[0] != "len" || names[len(names)-1] != "a.b_c.d" {
+		t.Errorf("wrong registration order: %v", names)
+	}
+
+	builtin, ok := r.Lookup("http.get")
+	if !ok {
+		t.Fatalf("http.get not registered")
+	}
+	result, err := builtin.Call(context.Background(), &Integer{Value: 1}, &Integer{Value: 2})
+	if err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	if result.(*Integer).Value != 2 {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
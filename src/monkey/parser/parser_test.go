@@ -349,6 +349,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a.b.c(1) + d[0].e",
+			"(((a.b).c)(1) + ((d[0]).e))",
+		},
+		{
+			"-req.header(\"x\")",
+			"(-(req.header)(x))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -762,6 +770,36 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingMemberExpressions(t *testing.T) {
+	input := "http.client.get"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	memberExp, ok := stmt.Expression.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MemberExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, memberExp.Property, "get") {
+		return
+	}
+
+	name, ok := memberExp.QualifiedName()
+	if !ok || name != "http.client.get" {
+		t.Errorf("wrong qualified name. got=%q (%t)", name, ok)
+	}
+
+	p = New(lexer.New("a.1"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected a parser error for a non-identifier property")
+	}
+}
+
 func TestParsingEmptyHashLiteral(t *testing.T) {
 	input := "{}"
 
@@ -805,7 +843,8 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		literal, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
@@ -840,7 +879,8 @@ func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		boolean, ok := key.(*ast.Boolean)
 		if !ok {
 			t.Errorf("key is not ast.BooleanLiteral. got=%T", key)
@@ -876,7 +916,8 @@ func TestParsingHashLiteralsIntegerKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		integer, ok := key.(*ast.IntegerLiteral)
 		if !ok {
 			t.Errorf("key is not ast.IntegerLiteral. got=%T", key)
@@ -919,7 +960,8 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		},
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		literal, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
@@ -1103,3 +1145,92 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestIncompleteInput(t *testing.T) {
+	tests := []struct {
+		input      string
+		incomplete bool
+	}{
+		{"let add = fn(a, b) {", true},
+		{"let add = fn(a, b) {\n  a +", true},
+		{"if (x) { 1 } else", true},
+		{"[1, 2,", true},
+		{`{"a": `, true},
+		{"puts(\"hello", true},
+		{"let x =", true},
+		{"foo.", true},
+		{"let x = 1;", false},
+		{"fn(a) { a }", false},
+		{"let = 1; fn(x) {", false},
+		{"1 + )", false},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if p.Incomplete() != tt.incomplete {
+			t.Errorf("Incomplete() for %q wrong. want=%t, got=%t (errors: %v)",
+				tt.input, tt.incomplete, p.Incomplete(), p.Errors())
+		}
+	}
+}
+
+func TestCommentsAndClosingPositions(t *testing.T) {
+	input := `// add two numbers
+let add = fn(a, b) {
+  a + b // the sum
+};
+add([1][0],
+  2)`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	comments := []string{}
+	for _, c := range program.Comments {
+		comments = append(comments, fmt.Sprintf("%s %s", c.Pos(), c.String()))
+	}
+	expected := "[1:1 // add two numbers 3:9 // the sum]"
+	if fmt.Sprint(comments) != expected {
+		t.Errorf("comments wrong. want=%s, got=%s", expected, comments)
+	}
+
+	fn := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if fn.Body.Rbrace.String() != "4:1" {
+		t.Errorf("block Rbrace wrong. want=4:1, got=%s", fn.Body.Rbrace)
+	}
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if call.Rparen.String() != "6:4" {
+		t.Errorf("call Rparen wrong. want=6:4, got=%s", call.Rparen)
+	}
+	index := call.Arguments[0].(*ast.IndexExpression)
+	if index.Rbracket.String() != "5:10" {
+		t.Errorf("index Rbracket wrong. want=5:10, got=%s", index.Rbracket)
+	}
+	if array := index.Left.(*ast.ArrayLiteral); array.Rbracket.String() != "5:7" {
+		t.Errorf("array Rbracket wrong. want=5:7, got=%s", array.Rbracket)
+	}
+}
+
+func TestParsingHashLiteralsKeepOrder(t *testing.T) {
+	input := `{"b": 1, "a": 2, "c": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	hash := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	keys := []string{}
+	for _, pair := range hash.Pairs {
+		keys = append(keys, pair.Key.String())
+	}
+	if fmt.Sprint(keys) != "[b a c]" {
+		t.Errorf("keys not in source order. got=%v", keys)
+	}
+	if hash.String() != "{b:1, a:2, c:3}" {
+		t.Errorf("hash.String() wrong. got=%q", hash.String())
+	}
+}
@@ -0,0 +1,176 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/compiler"
+	"reflect"
+	"strings"
+)
+
+const HELP = `Commands:
+  :engine [vm|eval]  show or switch the engine; each keeps its own globals
+  :disasm <source>   show the bytecode compiled for source
+  :ast <source>      show the syntax tree of source
+  :globals           list the global bindings and their values
+  :load <file>       evaluate a file
+  :reset             forget every binding
+  :time              toggle printing how long each entry took
+  :paste             enter source up to a line holding only '.'
+  :help              show this help
+
+On a terminal, Up and Down recall earlier lines, Ctrl-R searches them and
+Tab completes keywords, builtins, globals and commands.
+`
+
+// commandNames are the colon commands, for completion.
+var commandNames = []string{
+	":engine", ":disasm", ":ast", ":globals", ":load", ":reset", ":time", ":paste", ":help",
+}
+
+// command runs a colon command, e.g. ":engine eval".
+func (s *session) command(line string) {
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	switch name {
+	case ":engine":
+		switch arg {
+		case "":
+			fmt.Fprintf(s.out, "// engine: %s\n", s.engine)
+		case engineVM, engineEval:
+			s.engine = arg
+			fmt.Fprintf(s.out, "// engine: %s\n", s.engine)
+		default:
+			fmt.Fprintf(s.out, "// unknown engine %q, want vm or eval\n", arg)
+		}
+	case ":disasm":
+		bytecode, ok := s.compile(arg)
+		if ok {
+			bytecode.Disassemble(s.out)
+		}
+	case ":ast":
+		program, ok := s.parse(arg)
+		if ok {
+			printTree(s.out, "", reflect.ValueOf(program), 0)
+		}
+	case ":globals":
+		s.printGlobals()
+	case ":load":
+		if arg == "" {
+			fmt.Fprintln(s.out, "// usage: :load <file>")
+			return
+		}
+		src, err := ioutil.ReadFile(arg)
+		if err != nil {
+			fmt.Fprintf(s.out, "// %s\n", err)
+			return
+		}
+		s.eval(string(src))
+	case ":reset":
+		s.reset()
+		fmt.Fprintln(s.out, "// all bindings forgotten")
+	case ":time":
+		s.timing = !s.timing
+		if s.timing {
+			fmt.Fprintln(s.out, "// timing on")
+		} else {
+			fmt.Fprintln(s.out, "// timing off")
+		}
+	case ":help":
+		io.WriteString(s.out, HELP)
+	default:
+		fmt.Fprintf(s.out, "// unknown command %s, try :help\n", name)
+	}
+}
+
+func (s *session) printGlobals() {
+	if s.engine == engineEval {
+		for _, name := range s.env.Names() {
+			value, _ := s.env.Get(name)
+			fmt.Fprintf(s.out, "%s = %s\n", name, value.Inspect())
+		}
+		return
+	}
+	for _, symbol := range s.symbolTable.Symbols() {
+		if symbol.Scope != compiler.GlobalScope {
+			continue
+		}
+		value := "<unset>"
+		if v := s.globals[symbol.Index]; v != nil {
+			value = v.Inspect()
+		}
+		fmt.Fprintf(s.out, "%s = %s  // global %d\n", symbol.Name, value, symbol.Index)
+	}
+}
+
+var nodeType = reflect.TypeOf((*ast.Node)(nil)).Elem()
+
+// printTree prints node and its children, one per line, indented by depth.
+// label names the field of the parent holding node.
+func printTree(out io.Writer, label string, node reflect.Value, depth int) {
+	if node.IsNil() {
+		return
+	}
+	elem := node.Elem()
+	if node.Kind() == reflect.Interface {
+		node, elem = elem, elem.Elem()
+	}
+
+	line := strings.Repeat("  ", depth) + label + elem.Type().Name()
+	if detail := nodeDetail(elem); detail != "" {
+		line += " " + detail
+	}
+	if pos := node.Interface().(ast.Node).Pos(); pos.IsValid() {
+		line += "  // " + pos.String()
+	}
+	fmt.Fprintln(out, line)
+
+	for i := 0; i < elem.NumField(); i++ {
+		field, value := elem.Type().Field(i), elem.Field(i)
+		switch {
+		case field.Type.Implements(nodeType):
+			printTree(out, field.Name+": ", value, depth+1)
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Implements(nodeType):
+			for j := 0; j < value.Len(); j++ {
+				printTree(out, fmt.Sprintf("%s[%d]: ", field.Name, j), value.Index(j), depth+1)
+			}
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			// like the key/value pairs of a hash literal
+			for j := 0; j < value.Len(); j++ {
+				pair := value.Index(j)
+				for k := 0; k < pair.NumField(); k++ {
+					if pair.Type().Field(k).Type.Implements(nodeType) {
+						label := fmt.Sprintf("%s[%d].%s: ", field.Name, j, pair.Type().Field(k).Name)
+						printTree(out, label, pair.Field(k), depth+1)
+					}
+				}
+			}
+		}
+	}
+}
+
+// nodeDetail describes the scalar fields of a node, like the value of a
+// literal or the operator of an expression.
+func nodeDetail(elem reflect.Value) string {
+	details := []string{}
+	for _, name := range []string{"Value", "Operator", "Name"} {
+		field := elem.FieldByName(name)
+		if !field.IsValid() {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.String:
+			if field.String() != "" {
+				details = append(details, fmt.Sprintf("%q", field.String()))
+			}
+		case reflect.Int64, reflect.Bool:
+			details = append(details, fmt.Sprintf("%v", field.Interface()))
+		}
+	}
+	return strings.Join(details, " ")
+}
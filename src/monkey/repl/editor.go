@@ -0,0 +1,373 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// errInterrupted is returned by readLine when the user presses Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// Keys the editor understands besides printable characters.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+
+	// escape sequences are decoded into keys past the byte range
+	keyUp = 256 + iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDeleteForward
+	keyUnknown
+)
+
+// editor is a small line editor for terminals in raw mode. It supports
+// cursor movement, Emacs-style editing keys, history with reverse search
+// (Ctrl-R) and tab completion. The terminal handling itself lives in
+// term_*.go; the editor only reads keys from in and writes to out.
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  []string
+	complete func(prefix string) []string
+
+	prompt string
+	buf    []rune
+	pos    int // cursor position in buf
+}
+
+func newEditor(in io.Reader, out io.Writer, complete func(string) []string) *editor {
+	return &editor{in: bufio.NewReader(in), out: out, complete: complete}
+}
+
+// maxHistory bounds how many lines the editor remembers.
+const maxHistory = 1000
+
+func (e *editor) addHistory(line string) {
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// readLine prompts for a line and lets the user edit it. It returns
+// io.EOF on Ctrl-D at an empty line and errInterrupted on Ctrl-C.
+func (e *editor) readLine(prompt string) (string, error) {
+	e.prompt, e.buf, e.pos = prompt, nil, 0
+	// historyIndex is the history entry shown; len(history) is the line
+	// being typed, kept in draft while browsing.
+	historyIndex, draft := len(e.history), []rune(nil)
+	e.refresh()
+
+	for {
+		key, r, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case keyEnter, '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(e.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteForward()
+		case keyDelete, keyBackspace:
+			if e.pos > 0 {
+				e.buf = append(e.buf[:e.pos-1], e.buf[e.pos:]...)
+				e.pos--
+			}
+		case keyDeleteForward:
+			e.deleteForward()
+		case keyLeft, keyCtrlB:
+			if e.pos > 0 {
+				e.pos--
+			}
+		case keyRight, keyCtrlF:
+			if e.pos < len(e.buf) {
+				e.pos++
+			}
+		case keyHome, keyCtrlA:
+			e.pos = 0
+		case keyEnd, keyCtrlE:
+			e.pos = len(e.buf)
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+		case keyCtrlU:
+			e.buf = append([]rune{}, e.buf[e.pos:]...)
+			e.pos = 0
+		case keyCtrlW:
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyUp, keyCtrlP, keyDown, keyCtrlN:
+			next := historyIndex - 1
+			if key == keyDown || key == keyCtrlN {
+				next = historyIndex + 1
+			}
+			if next < 0 || next > len(e.history) {
+				break
+			}
+			if historyIndex == len(e.history) {
+				draft = e.buf
+			}
+			historyIndex = next
+			if historyIndex == len(e.history) {
+				e.buf = draft
+			} else {
+				e.buf = []rune(e.history[historyIndex])
+			}
+			e.pos = len(e.buf)
+		case keyTab:
+			e.completeWord()
+		case keyCtrlR:
+			line, accepted, err := e.search()
+			if err != nil {
+				return "", err
+			}
+			if accepted {
+				fmt.Fprint(e.out, "\r\n")
+				return line, nil
+			}
+		case 0:
+			e.insert(r)
+		}
+		e.refresh()
+	}
+}
+
+func (e *editor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.pos+1:], e.buf[e.pos:])
+	e.buf[e.pos] = r
+	e.pos++
+}
+
+func (e *editor) deleteForward() {
+	if e.pos < len(e.buf) {
+		e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+	}
+}
+
+// refresh redraws the prompt and the line and places the cursor.
+func (e *editor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+	fmt.Fprint(e.out, "\r")
+	// terminals read a count of 0 as 1
+	if col := utf8.RuneCountInString(e.prompt) + e.pos; col > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dC", col)
+	}
+}
+
+// readKey reads one key press. For printable characters key is 0 and r
+// holds the character.
+func (e *editor) readKey() (key int, r rune, err error) {
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0, 0, err
+	}
+	if r >= ' ' && r != keyDelete {
+		return 0, r, nil
+	}
+	if r != keyEscape {
+		return int(r), 0, nil
+	}
+
+	// ESC [ x, ESC O x or ESC [ n ~
+	b, err := e.in.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	if b != '[' && b != 'O' {
+		return keyUnknown, 0, nil
+	}
+	b, err = e.in.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	switch b {
+	case 'A':
+		return keyUp, 0, nil
+	case 'B':
+		return keyDown, 0, nil
+	case 'C':
+		return keyRight, 0, nil
+	case 'D':
+		return keyLeft, 0, nil
+	case 'H':
+		return keyHome, 0, nil
+	case 'F':
+		return keyEnd, 0, nil
+	}
+	if b < '0' || b > '9' {
+		return keyUnknown, 0, nil
+	}
+	n := int(b - '0')
+	for {
+		b, err = e.in.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		if b < '0' || b > '9' {
+			break
+		}
+		n = n*10 + int(b-'0')
+	}
+	if b != '~' {
+		return keyUnknown, 0, nil
+	}
+	switch n {
+	case 1, 7:
+		return keyHome, 0, nil
+	case 3:
+		return keyDeleteForward, 0, nil
+	case 4, 8:
+		return keyEnd, 0, nil
+	}
+	return keyUnknown, 0, nil
+}
+
+// search is reverse incremental search through the history. Enter runs
+// the match, Ctrl-G and Ctrl-C give up and restore the line, and any other
+// key ends the search with the match in the line for editing.
+func (e *editor) search() (line string, accepted bool, err error) {
+	saved, savedPos := e.buf, e.pos
+	query := []rune{}
+	match, index := "", len(e.history)
+
+	// find looks for the query in the history from index from backwards
+	// and reports whether it found it.
+	find := func(from int) bool {
+		if from >= len(e.history) {
+			from = len(e.history) - 1
+		}
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				match, index = e.history[i], i
+				return true
+			}
+		}
+		return false
+	}
+
+	for {
+		// like readline, say so when no line matches what was typed
+		state := "reverse-i-search"
+		if len(query) > 0 && match == "" {
+			state = "failed reverse-i-search"
+		}
+		fmt.Fprintf(e.out, "\r(%s)`%s': %s\x1b[K", state, string(query), match)
+		key, r, err := e.readKey()
+		if err != nil {
+			return "", false, err
+		}
+		switch key {
+		case 0:
+			query = append(query, r)
+			if !find(index) {
+				match = ""
+			}
+		case keyCtrlR:
+			find(index - 1)
+		case keyDelete, keyBackspace:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				if !find(len(e.history) - 1) {
+					match = ""
+				}
+			}
+		case keyCtrlG, keyCtrlC:
+			e.buf, e.pos = saved, savedPos
+			return "", false, nil
+		case keyEnter, '\n':
+			return match, true, nil
+		default:
+			e.buf = []rune(match)
+			e.pos = len(e.buf)
+			return "", false, nil
+		}
+	}
+}
+
+// completeWord completes the word before the cursor. A single candidate
+// is inserted; several are listed after extending the word by their
+// common prefix.
+func (e *editor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	start := e.pos
+	for start > 0 && isWordRune(e.buf[start-1]) {
+		start--
+	}
+	prefix := string(e.buf[start:e.pos])
+	candidates := e.complete(prefix)
+	if len(candidates) == 0 {
+		return
+	}
+
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(candidates) == 1 {
+		common += " "
+	}
+	if len(common) > len(prefix) {
+		for _, r := range common[len(prefix):] {
+			e.insert(r)
+		}
+		return
+	}
+
+	sort.Strings(candidates)
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+}
+
+func isWordRune(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' ||
+		r == '_' || r == '.' || r == ':'
+}
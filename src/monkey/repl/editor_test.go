@@ -0,0 +1,148 @@
+package repl
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEditorReadLine(t *testing.T) {
+	tests := []struct {
+		keys     string
+		history  []string
+		expected string
+	}{
+		{"let x = 1;\r", nil, "let x = 1;"},
+		{"ab\x7fc\r", nil, "ac"},
+		{"bc\x1b[D\x1b[Da\r", nil, "abc"},
+		{"bc\x01a\x05d\r", nil, "abcd"},
+		{"abc\x1b[H\x1b[3~\r", nil, "bc"},
+		{"abc def\x17\r", nil, "abc "},
+		{"abcdef\x1b[D\x1b[D\x0b\r", nil, "abcd"},
+		{"abcdef\x1b[D\x1b[D\x15\r", nil, "ef"},
+		{"\x1b[A\r", []string{"one", "two"}, "two"},
+		{"\x1b[A\x1b[A\r", []string{"one", "two"}, "one"},
+		{"new\x1b[A\x1b[B\r", []string{"one"}, "new"},
+		{"\x12on\r", []string{"one", "two", "bone"}, "bone"},
+		{"\x12on\x12\r", []string{"one", "two", "bone"}, "one"},
+		{"x\x12tw\x07\r", []string{"two"}, "x"},
+		{"\x12tw\x1b[D!\r", []string{"two"}, "two!"},
+		{"\x12abz\r", []string{"abc"}, ""},
+		{"\x12abz\x7f\r", []string{"abc"}, "abc"},
+		{"pu\t\r", nil, "puts "},
+		{"f\t\r", nil, "f"},
+		{"fi\t\r", nil, "first "},
+	}
+
+	complete := func(prefix string) []string {
+		matches := []string{}
+		for _, name := range []string{"false", "first", "fn", "puts"} {
+			if strings.HasPrefix(name, prefix) {
+				matches = append(matches, name)
+			}
+		}
+		return matches
+	}
+
+	for _, tt := range tests {
+		e := newEditor(strings.NewReader(tt.keys), io.Discard, complete)
+		e.history = tt.history
+		line, err := e.readLine(PROMPT)
+		if err != nil {
+			t.Errorf("readLine(%q) returned error: %s", tt.keys, err)
+			continue
+		}
+		if line != tt.expected {
+			t.Errorf("readLine(%q) wrong. want=%q, got=%q", tt.keys, tt.expected, line)
+		}
+	}
+}
+
+func TestEditorInterrupts(t *testing.T) {
+	e := newEditor(strings.NewReader("abc\x03\x04"), io.Discard, nil)
+	_, err := e.readLine(PROMPT)
+	if err != errInterrupted {
+		t.Errorf("Ctrl-C wrong. want=errInterrupted, got=%v", err)
+	}
+	_, err = e.readLine(PROMPT)
+	if err != io.EOF {
+		t.Errorf("Ctrl-D wrong. want=io.EOF, got=%v", err)
+	}
+}
+
+func TestEditorListsCompletions(t *testing.T) {
+	var out bytes.Buffer
+	complete := func(string) []string { return []string{"fn", "false"} }
+	e := newEditor(strings.NewReader("f\t\r"), &out, complete)
+	e.readLine(PROMPT)
+	if !strings.Contains(out.String(), "\r\nfalse  fn\r\n") {
+		t.Errorf("candidates not listed. got=%q", out.String())
+	}
+}
+
+func TestEditorFailedSearch(t *testing.T) {
+	var out bytes.Buffer
+	e := newEditor(strings.NewReader("\x12abz\r"), &out, nil)
+	e.history = []string{"abc"}
+	e.readLine(PROMPT)
+	if !strings.Contains(out.String(), "(failed reverse-i-search)`abz': \x1b[K") {
+		t.Errorf("failed search not shown. got=%q", out.String())
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".monkey_history")
+	if history := loadHistory(path); len(history) != 0 {
+		t.Fatalf("missing history file not empty. got=%q", history)
+	}
+	appendHistory(path, "let x = 1;")
+	appendHistory(path, "x + 1")
+
+	history := loadHistory(path)
+	expected := []string{"let x = 1;", "x + 1"}
+	if !reflect.DeepEqual(history, expected) {
+		t.Errorf("history wrong. want=%q, got=%q", expected, history)
+	}
+
+	for i := 0; i < maxHistory-1; i++ {
+		appendHistory(path, "1")
+	}
+	if history := loadHistory(path); len(history) != maxHistory || history[0] != "x + 1" {
+		t.Errorf("history not trimmed to %d lines. got %d starting %q", maxHistory, len(history), history[0])
+	}
+	data, _ := ioutil.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != maxHistory {
+		t.Errorf("history file not trimmed. got %d lines", lines)
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	tests := []struct {
+		engine   string
+		prefix   string
+		expected []string
+	}{
+		{engineVM, "le", []string{"len", "let", "letter"}},
+		{engineVM, "fi", []string{"first"}},
+		{engineEval, "le", []string{"len", "let", "letters"}},
+		{engineVM, ":e", []string{":engine"}},
+	}
+
+	s := newSession(context.Background(), io.Discard)
+	s.eval("let letter = 1;")
+	s.engine = engineEval
+	s.eval("let letters = 2;")
+
+	for _, tt := range tests {
+		s.engine = tt.engine
+		got := s.completions(tt.prefix)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("completions(%q) on %s wrong. want=%q, got=%q", tt.prefix, tt.engine, tt.expected, got)
+		}
+	}
+}
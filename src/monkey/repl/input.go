@@ -0,0 +1,116 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lineReader reads the lines of the REPL's entries.
+type lineReader interface {
+	// readLine shows prompt and returns the next line without its line
+	// ending. It returns io.EOF at the end of the input and errInterrupted
+	// when the user abandons the line.
+	readLine(prompt string) (string, error)
+}
+
+// newLineReader returns a line editor when in is a terminal and reads
+// plain lines otherwise, e.g. when input is piped in.
+func newLineReader(in io.Reader, out io.Writer, complete func(string) []string) lineReader {
+	f, ok := in.(*os.File)
+	if !ok || !isTerminal(f.Fd()) {
+		return &plainReader{scanner: bufio.NewScanner(in), out: out}
+	}
+	r := &terminalReader{fd: f.Fd(), editor: newEditor(in, out, complete), historyFile: historyPath()}
+	r.editor.history = loadHistory(r.historyFile)
+	return r
+}
+
+type plainReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *plainReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// terminalReader edits lines in raw mode and remembers them in the
+// history file. The terminal is only raw while a line is being edited, so
+// programs print as usual.
+type terminalReader struct {
+	fd          uintptr
+	editor      *editor
+	historyFile string
+}
+
+func (r *terminalReader) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	line, err := r.editor.readLine(prompt)
+	restore()
+	if err == nil && strings.TrimSpace(line) != "" {
+		r.editor.addHistory(line)
+		appendHistory(r.historyFile, line)
+	}
+	return line, err
+}
+
+// historyPath returns the path of the history file, ~/.monkey_history, or
+// "" when there is no home directory.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+// loadHistory returns the last maxHistory lines of the history file. It
+// trims a longer file so it does not grow without bound. A missing or
+// unreadable file is an empty history.
+func loadHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+		ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	}
+	return lines
+}
+
+// appendHistory adds line to the history file. History is a convenience,
+// so failing to write it is not reported.
+func appendHistory(path, line string) {
+	if path == "" {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
@@ -1,71 +1,103 @@
 package repl
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"monkey/compiler"
-	"monkey/object"
-	// "monkey/evaluator"
 	"monkey/lexer"
-	// "monkey/object"
 	"monkey/parser"
 	"monkey/vm"
+	"strings"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	// env := object.NewEnvironment()
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalsSize)
-	symbolTable := compiler.NewSymbolTable()
-	for i, v := range object.Builtins{
-		symbolTable.DefineBuiltin(i, v.Name)
-	}
+// CONTINUATION_PROMPT asks for the rest of an incomplete entry.
+const CONTINUATION_PROMPT = ".. "
+
+// Start reads entries from in and writes their results to out until in
+// is exhausted or ctx is done. An entry still running when ctx is done is
+// stopped with an error.
+func Start(ctx context.Context, in io.Reader, out io.Writer) {
+	s := newSession(ctx, out)
+	lines := newLineReader(in, out, s.completions)
 	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		entry, err := readEntry(lines, out)
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
 			return
 		}
+		line := strings.TrimSpace(entry)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, ":"):
+			s.command(line)
+		default:
+			s.eval(entry)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+// readEntry reads one entry, prompting for more lines while the input so
+// far is incomplete, like a function whose closing brace is still to come.
+// A blank continuation line ends the entry early, so a typo cannot trap
+// the user; to enter source with blank lines, paste it after :paste.
+func readEntry(lines lineReader, out io.Writer) (string, error) {
+	entry, err := lines.readLine(PROMPT)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(entry) == ":paste" {
+		return readPaste(lines, out)
+	}
 
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
+	for incomplete(entry) {
+		line, err := lines.readLine(CONTINUATION_PROMPT)
+		if err == io.EOF {
+			break
 		}
-		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(program)
 		if err != nil {
-			fmt.Fprintf(out, "Woop! Compilation failed: \n %s\n", err)
-			continue
+			return "", err
 		}
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		entry += "\n" + line
+	}
+	return entry, nil
+}
 
-		code := comp.Bytecode()
-		constants = code.Constans
-
-		machine := vm.NewWithGlobalsStore(code, globals)
-		err = machine.Run()
+// readPaste reads everything up to a line holding only "." or the end of
+// the input as a single entry.
+func readPaste(lines lineReader, out io.Writer) (string, error) {
+	fmt.Fprintln(out, "// paste mode: end with a line holding only '.' or Ctrl-D")
+	entry := []string{}
+	for {
+		line, err := lines.readLine("")
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			fmt.Fprintf(out, "Woop! Executing bytecode failed: \n %s\n", err)
-			continue
+			return "", err
 		}
-		stackTop := machine.LastPoppedStackElm()
-		io.WriteString(out, stackTop.Inspect())
-		io.WriteString(out, "\n")
-
-		// evaluated := evaluator.Eval(program, env)
-		// if evaluated != nil {
-		// 	io.WriteString(out, evaluated.Inspect())
-		// 	io.WriteString(out, "\n")
-		// }
+		if strings.TrimSpace(line) == "." {
+			break
+		}
+		entry = append(entry, line)
 	}
+	return strings.Join(entry, "\n"), nil
+}
+
+func incomplete(input string) bool {
+	p := parser.New(lexer.New(input))
+	p.ParseProgram()
+	return p.Incomplete()
 }
 
 const MONKEY_FACE = `            __,__
@@ -89,3 +121,10 @@ func printParserErrors(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+func printStackTrace(out io.Writer, err error) {
+	var rerr *vm.RuntimeError
+	if errors.As(err, &rerr) {
+		io.WriteString(out, rerr.StackTrace())
+	}
+}
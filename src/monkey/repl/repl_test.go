@@ -0,0 +1,184 @@
+package repl
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMultiLineInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "add(1,\n2)\n",
+			expected: ">> .. ",
+		},
+		{
+			input:    "let add = fn(a, b) {\n  a + b\n};\nadd(1,\n2)\n",
+			expected: ".. 3\n>> ",
+		},
+		{
+			input:    "let s = \"a\nb\";\ns\n",
+			expected: ">> a\nb\n>> ",
+		},
+		{
+			input:    "[1,\n\n4\n",
+			expected: "parser errors:\n\tno prefix parse function for EOF found\n\texpected next token to be ], got EOF instead\n>> 4\n",
+		},
+		{
+			input:    ":paste\nlet f = fn(x) {\n\n  x * 2\n};\nf(4)\n.\n5\n",
+			expected: "Ctrl-D\n8\n>> 5\n>> ",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(context.Background(), strings.NewReader(tt.input), &out)
+		if !strings.Contains(out.String(), tt.expected) {
+			t.Errorf("output for %q does not contain %q. got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"fn(x) {", true},
+		{"1 +", true},
+		{`"abc`, true},
+		{"fn(x) { x }", false},
+		{"let = 1", false},
+	}
+
+	for _, tt := range tests {
+		if incomplete(tt.input) != tt.expected {
+			t.Errorf("incomplete(%q) wrong. want=%t", tt.input, tt.expected)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			input: "let x = 5;\n:globals\n:disasm let y = x;\ny\n",
+			expected: []string{
+				"x = 5  // global 0\n",
+				"OpGetGlobal 0\n",
+				"OpSetGlobal 1\n",
+				"undefined variable y",
+			},
+		},
+		{
+			input: ":ast -a * 2\n",
+			expected: []string{
+				"Expression: InfixExpression \"*\"  // 1:4\n",
+				"      Left: PrefixExpression \"-\"  // 1:1\n",
+				"        Right: Identifier \"a\"  // 1:2\n",
+				"      Right: IntegerLiteral 2  // 1:6\n",
+			},
+		},
+		{
+			input: "let x = 1;\n:engine eval\nx\nlet x = 2;\n:globals\n:engine vm\nx\n:engine jit\n",
+			expected: []string{
+				"// engine: eval\n>> ERROR: identifier not found: x\n",
+				">> x = 2\n",
+				"// engine: vm\n>> 1\n",
+				"unknown engine \"jit\"",
+			},
+		},
+		{
+			input:    "let x = 1;\n:reset\nx\n",
+			expected: []string{"// all bindings forgotten\n", "undefined variable x"},
+		},
+		{
+			input:    ":time\n1 + 1\n:time\n2\n",
+			expected: []string{"2\n// took ", "// timing off\n>> 2\n"},
+		},
+		{
+			input:    ":load does-not-exist.monkey\n:nope\n:help\n",
+			expected: []string{"no such file or directory", "unknown command :nope", "Commands:\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(context.Background(), strings.NewReader(tt.input), &out)
+		for _, want := range tt.expected {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("output for %q does not contain %q. got=%q", tt.input, want, out.String())
+			}
+		}
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			// the failed entry defined a before compiling the undefined b
+			input:    "let a = b;\n:globals\nlet c = 1;\n:globals\n",
+			expected: []string{"undefined variable b\n>> >> ", ">> c = 1  // global 0\n"},
+		},
+		{
+			input:    "let a = 1; let b = a + true;\n:globals\na\n",
+			expected: []string{"unsupported types", ">> >> Woop! Compilation failed: \n undefined variable a"},
+		},
+		{
+			input:    "let x = 1;\nlet x = 2; x\n:globals\n",
+			expected: []string{"// x redefined, previous value 1 replaced\n2\n", "x = 2  // global 1\n"},
+		},
+		{
+			input:    "let x = 1;\nlet x = 2; x + true\nx\n",
+			expected: []string{">> 1\n"},
+		},
+		{
+			input: ":engine eval\nlet x = 1;\nlet x = 2; let y = 3; x + true\n:globals\nlet x = 4;\n",
+			expected: []string{
+				"type mismatch",
+				">> x = 1\n>> ",
+				"// x redefined, previous value 1 replaced\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(context.Background(), strings.NewReader(tt.input), &out)
+		for _, want := range tt.expected {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("output for %q does not contain %q. got=%q", tt.input, want, out.String())
+			}
+		}
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	countdown := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(500)\n1 + 1\n"
+	inputs := []string{
+		countdown,
+		":engine eval\n" + countdown,
+	}
+
+	for _, input := range inputs {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var out bytes.Buffer
+		Start(ctx, strings.NewReader(input), &out)
+		if !strings.Contains(out.String(), "context canceled") {
+			t.Errorf("output for %q does not contain %q. got=%q", input, "context canceled", out.String())
+		}
+		if strings.Contains(out.String(), "2\n") {
+			t.Errorf("REPL kept reading %q after ctx was done. got=%q", input, out.String())
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"monkey/vm"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	engineVM   = "vm"
+	engineEval = "eval"
+)
+
+// session is the state the REPL keeps between entries. The engines do not
+// share bindings: each keeps its own globals.
+type session struct {
+	// ctx stops the entry being run once it is done.
+	ctx    context.Context
+	out    io.Writer
+	engine string
+	timing bool
+
+	// vm engine
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+
+	// eval engine
+	env *object.Environment
+}
+
+func newSession(ctx context.Context, out io.Writer) *session {
+	s := &session{ctx: ctx, out: out, engine: engineVM}
+	s.reset()
+	return s
+}
+
+// reset forgets every binding of both engines.
+func (s *session) reset() {
+	s.constants = []object.Object{}
+	s.globals = make([]object.Object, vm.GlobalsSize)
+	s.symbolTable = compiler.NewSymbolTable()
+	for i, name := range object.NewRegistry().Names() {
+		s.symbolTable.DefineBuiltin(i, name)
+	}
+	s.env = object.NewEnvironmentWithContext(s.ctx, 0)
+}
+
+// eval runs src on the current engine and prints its value. An entry
+// either succeeds as a whole or leaves the session as it was before.
+func (s *session) eval(src string) {
+	start := time.Now()
+	program, ok := s.parse(src)
+	if !ok {
+		return
+	}
+
+	var result object.Object
+	previous := s.previousValues(program)
+	if s.engine == engineEval {
+		result, ok = s.evaluate(program)
+	} else {
+		result, ok = s.run(program)
+	}
+	if ok {
+		for _, name := range sortedNames(previous) {
+			fmt.Fprintf(s.out, "// %s redefined, previous value %s replaced\n", name, previous[name].Inspect())
+		}
+	}
+	if result != nil {
+		io.WriteString(s.out, result.Inspect())
+		io.WriteString(s.out, "\n")
+	}
+	if s.timing {
+		fmt.Fprintf(s.out, "// took %s\n", time.Since(start))
+	}
+}
+
+func (s *session) parse(src string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors())
+		return nil, false
+	}
+	return program, true
+}
+
+// run compiles and runs program on the vm. Compiling defines symbols and
+// adds constants even when it fails part way, so it works on a copy of the
+// symbol table and the session keeps the copy and the new constants only
+// once the entry ran without error. Globals need no copy: every let gets a
+// fresh slot, and the slots of rolled back symbols are simply reused.
+func (s *session) run(program *ast.Program) (object.Object, bool) {
+	symbolTable := s.symbolTable.Clone()
+	comp := compiler.NewWithState(symbolTable, s.constants)
+	err := comp.Compile(program)
+	if err != nil {
+		fmt.Fprintf(s.out, "Woop! Compilation failed: \n %s\n", err)
+		return nil, false
+	}
+
+	code := comp.Bytecode()
+	machine := vm.NewWithGlobalsStore(code, s.globals)
+	err = machine.RunContext(s.ctx)
+	if err != nil {
+		fmt.Fprintf(s.out, "Woop! Executing bytecode failed: \n %s\n", err)
+		printStackTrace(s.out, err)
+		return nil, false
+	}
+	s.symbolTable = symbolTable
+	s.constants = code.Constans
+	return machine.LastPoppedStackElm(), true
+}
+
+// evaluate runs program on the evaluator. When the entry ends in an error
+// the bindings it made or changed are put back the way they were.
+func (s *session) evaluate(program *ast.Program) (object.Object, bool) {
+	before := map[string]object.Object{}
+	for _, name := range s.env.Names() {
+		before[name], _ = s.env.Get(name)
+	}
+
+	result := evaluator.Eval(program, s.env)
+	if _, failed := result.(*object.Error); !failed {
+		return result, true
+	}
+	for _, name := range s.env.Names() {
+		if value, ok := before[name]; ok {
+			s.env.Set(name, value)
+		} else {
+			s.env.Delete(name)
+		}
+	}
+	return result, false
+}
+
+// previousValues returns the current values of the globals that the top
+// level let statements of program define again.
+func (s *session) previousValues(program *ast.Program) map[string]object.Object {
+	previous := map[string]object.Object{}
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		name := let.Name.Value
+		if s.engine == engineEval {
+			if value, ok := s.env.Get(name); ok {
+				previous[name] = value
+			}
+			continue
+		}
+		symbol, ok := s.symbolTable.Resolve(name)
+		if ok && symbol.Scope == compiler.GlobalScope && s.globals[symbol.Index] != nil {
+			previous[name] = s.globals[symbol.Index]
+		}
+	}
+	return previous
+}
+
+func sortedNames(values map[string]object.Object) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compile compiles src against a copy of the session's symbol table, so
+// looking at the bytecode of an entry does not define anything. The
+// constant pool starts out empty to keep the listing to this entry.
+func (s *session) compile(src string) (*compiler.Bytecode, bool) {
+	program, ok := s.parse(src)
+	if !ok {
+		return nil, false
+	}
+	comp := compiler.NewWithState(s.symbolTable.Clone(), []object.Object{})
+	err := comp.Compile(program)
+	if err != nil {
+		fmt.Fprintf(s.out, "Woop! Compilation failed: \n %s\n", err)
+		return nil, false
+	}
+	return comp.Bytecode(), true
+}
+
+// completions returns the keywords, builtins, globals and, for a prefix
+// starting with ':', the commands that start with prefix.
+func (s *session) completions(prefix string) []string {
+	names := []string{}
+	if strings.HasPrefix(prefix, ":") {
+		names = append(names, commandNames...)
+	} else {
+		names = append(names, token.Keywords()...)
+		// the registry holds object.Builtins and the namespaced builtins
+		names = append(names, object.NewRegistry().Names()...)
+		if s.engine == engineEval {
+			names = append(names, s.env.Names()...)
+		} else {
+			for _, symbol := range s.symbolTable.Symbols() {
+				if symbol.Scope == compiler.GlobalScope {
+					names = append(names, symbol.Name)
+				}
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	matches := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// isTerminal reports whether fd refers to a terminal. Line editing is only
+// implemented on Linux; elsewhere the REPL reads plain lines.
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (restore func() error, err error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
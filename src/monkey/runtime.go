@@ -0,0 +1,213 @@
+// Package monkey embeds the Monkey language in Go programs.
+//
+// A Runtime compiles source to bytecode and runs it on the VM. Global
+// bindings live as long as the Runtime, so every Compile and Run sees the
+// globals of the ones before it, just like entries in the REPL.
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"strings"
+)
+
+// Runtime is not safe for concurrent use.
+type Runtime struct {
+	builtins    *object.Registry
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+	options     vm.Options
+}
+
+// Program is source compiled by a Runtime. It can only be run by the
+// Runtime that compiled or loaded it.
+type Program struct {
+	bytecode *compiler.Bytecode
+}
+
+// ParseError reports the syntax errors found in the source.
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parser errors:\n\t" + strings.Join(e.Errors, "\n\t")
+}
+
+func New() *Runtime {
+	return NewWithOptions(vm.Options{})
+}
+
+// NewWithOptions creates a Runtime whose programs run with the given VM
+// limits. opts.Globals and opts.Builtins are ignored; the Runtime keeps its
+// own globals and builtins.
+func NewWithOptions(opts vm.Options) *Runtime {
+	globalsSize := opts.GlobalsSize
+	if globalsSize <= 0 {
+		globalsSize = vm.GlobalsSize
+	}
+	builtins := object.NewRegistry()
+	symbolTable := compiler.NewSymbolTable()
+	for i, name := range builtins.Names() {
+		symbolTable.DefineBuiltin(i, name)
+	}
+	r := &Runtime{
+		builtins:    builtins,
+		symbolTable: symbolTable,
+		constants:   []object.Object{},
+		globals:     make([]object.Object, globalsSize),
+		options:     opts,
+	}
+	r.options.Globals = r.globals
+	r.options.Builtins = builtins
+	return r
+}
+
+// Register makes fn callable from scripts compiled afterwards under name,
+// which may be namespaced with dots like "http.get". Registering a name
+// again replaces the function, also for programs compiled before.
+func (r *Runtime) Register(name string, fn object.HostFunction) error {
+	err := r.builtins.Register(name, fn)
+	if err != nil {
+		return err
+	}
+	r.defineBuiltin(name)
+	return nil
+}
+
+// RegisterFunc is like Register for a Go function of any signature; see
+// object.WrapFunc for how arguments and results are converted.
+func (r *Runtime) RegisterFunc(name string, fn interface{}) error {
+	err := r.builtins.RegisterFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	r.defineBuiltin(name)
+	return nil
+}
+
+// SetGlobalValue is like SetGlobal for a Go value, converted with
+// object.FromGo.
+func (r *Runtime) SetGlobalValue(name string, value interface{}) error {
+	obj, err := object.FromGo(value)
+	if err != nil {
+		return err
+	}
+	return r.SetGlobal(name, obj)
+}
+
+func (r *Runtime) defineBuiltin(name string) {
+	for i, n := range r.builtins.Names() {
+		if n == name {
+			r.symbolTable.DefineBuiltin(i, name)
+		}
+	}
+}
+
+// Builtins returns the registry the Runtime's programs resolve builtins
+// from, e.g. to share it with an evaluator environment.
+func (r *Runtime) Builtins() *object.Registry {
+	return r.builtins
+}
+
+func (r *Runtime) Compile(src string) (*Program, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	comp := compiler.NewWithState(r.symbolTable, r.constants)
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+	bytecode := comp.Bytecode()
+	r.constants = bytecode.Constans
+	return &Program{bytecode: bytecode}, nil
+}
+
+// MarshalBinary encodes the program in the portable bytecode format, e.g.
+// to write it to a .mbc file; see Runtime.Load.
+func (p *Program) MarshalBinary() ([]byte, error) {
+	return p.bytecode.MarshalBinary()
+}
+
+// Disassemble writes a listing of the program's bytecode to w.
+func (p *Program) Disassemble(w io.Writer) error {
+	return p.bytecode.Disassemble(w)
+}
+
+// Load decodes and verifies bytecode written by Program.MarshalBinary.
+// Globals are bound by index, so the Runtime must have the same globals
+// set, in the same order, as the one that compiled the program.
+func (r *Runtime) Load(data []byte) (*Program, error) {
+	bytecode := &compiler.Bytecode{}
+	err := bytecode.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	err = vm.Verify(bytecode, len(r.globals))
+	if err != nil {
+		return nil, err
+	}
+	return &Program{bytecode: bytecode}, nil
+}
+
+// Run executes the program and returns the value of its last expression
+// statement.
+func (r *Runtime) Run(ctx context.Context, program *Program) (object.Object, error) {
+	machine := vm.NewWithOptions(program.bytecode, r.options)
+	err := machine.RunContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := machine.LastPoppedStackElm()
+	if result == nil {
+		return vm.Null, nil
+	}
+	return result, nil
+}
+
+// Eval compiles and runs src in one step.
+func (r *Runtime) Eval(ctx context.Context, src string) (object.Object, error) {
+	program, err := r.Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	return r.Run(ctx, program)
+}
+
+// SetGlobal binds name to value as if the script had run `let name = value;`.
+func (r *Runtime) SetGlobal(name string, value object.Object) error {
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		symbol = r.symbolTable.Define(name)
+	}
+	if symbol.Index >= len(r.globals) {
+		return fmt.Errorf("too many globals: limit is %d", len(r.globals))
+	}
+	r.globals[symbol.Index] = value
+	return nil
+}
+
+// Global returns the current value of the global variable name.
+func (r *Runtime) Global(name string) (object.Object, bool) {
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || symbol.Index >= len(r.globals) {
+		return nil, false
+	}
+	value := r.globals[symbol.Index]
+	if value == nil {
+		return nil, false
+	}
+	return value, true
+}
@@ -0,0 +1,219 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"monkey/object"
+	"monkey/vm"
+	"testing"
+)
+
+func TestRuntimeEval(t *testing.T) {
+	r := New()
+	result, err := r.Eval(context.Background(), `let double = fn(x) { x * 2 }; double(21)`)
+	if err != nil {
+		t.Fatalf("eval error: %s", err)
+	}
+	testIntegerObject(t, result, 42)
+
+	// globals from the previous call are still visible.
+	result, err = r.Eval(context.Background(), `double(4)`)
+	if err != nil {
+		t.Fatalf("eval error: %s", err)
+	}
+	testIntegerObject(t, result, 8)
+}
+
+func TestRuntimeGlobals(t *testing.T) {
+	r := New()
+	err := r.SetGlobal("limit", &object.Integer{Value: 10})
+	if err != nil {
+		t.Fatalf("SetGlobal error: %s", err)
+	}
+
+	program, err := r.Compile(`let total = limit * 3; total + 1`)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	result, err := r.Run(context.Background(), program)
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	testIntegerObject(t, result, 31)
+
+	total, ok := r.Global("total")
+	if !ok {
+		t.Fatalf("global total not found")
+	}
+	testIntegerObject(t, total, 30)
+
+	if _, ok := r.Global("missing"); ok {
+		t.Errorf("Global returned a value for an undefined name")
+	}
+	if _, ok := r.Global("len"); ok {
+		t.Errorf("Global returned a value for a builtin")
+	}
+
+	// running the same program again sees the updated global.
+	r.SetGlobal("limit", &object.Integer{Value: 1})
+	result, err = r.Run(context.Background(), program)
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	testIntegerObject(t, result, 4)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	r := New()
+	_, err := r.Compile(`let = 5;`)
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected *ParseError. got=%T (%v)", err, err)
+	}
+
+	_, err = r.Compile(`undefinedName`)
+	if err == nil || err.Error() != "undefined variable undefinedName" {
+		t.Errorf("wrong compile error. got=%v", err)
+	}
+
+	_, err = r.Eval(context.Background(), `1(2)`)
+	var rerr *vm.RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Errorf("expected *vm.RuntimeError. got=%T (%v)", err, err)
+	}
+
+	_, err = r.Eval(context.Background(), `10 / 0`)
+	if !errors.As(err, &rerr) || err.Error() != "division by zero" {
+		t.Errorf("expected division by zero *vm.RuntimeError. got=%T (%v)", err, err)
+	}
+
+	limited := NewWithOptions(vm.Options{MaxSteps: 100})
+	_, err = limited.Eval(context.Background(), `
+	let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } };
+	fib(20)`)
+	if !errors.Is(err, vm.ErrBudgetExceeded) {
+		t.Errorf("expected ErrBudgetExceeded. got=%v", err)
+	}
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) {
+	t.Helper()
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Fatalf("object is not Integer. got=%T (%+v)", obj, obj)
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+}
+
+func TestRuntimeRegister(t *testing.T) {
+	r := New()
+	err := r.Register("config.get", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return &object.String{Value: "value of " + args[0].Inspect()}, nil
+	})
+	if err != nil {
+		t.Fatalf("Register error: %s", err)
+	}
+	err = r.Register("answer", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return &object.Integer{Value: 42}, nil
+	})
+	if err != nil {
+		t.Fatalf("Register error: %s", err)
+	}
+
+	result, err := r.Eval(context.Background(), `answer() + len("ab")`)
+	if err != nil {
+		t.Fatalf("eval error: %s", err)
+	}
+	testIntegerObject(t, result, 44)
+
+	builtin, ok := r.Builtins().Lookup("config.get")
+	if !ok {
+		t.Fatalf("config.get not registered")
+	}
+	value, _ := builtin.Call(context.Background(), &object.String{Value: "port"})
+	if value.Inspect() != "value of port" {
+		t.Errorf("wrong value. got=%q", value.Inspect())
+	}
+}
+
+func TestRuntimeGoValues(t *testing.T) {
+	type limits struct {
+		Max   int      `monkey:"max"`
+		Names []string `monkey:"names"`
+	}
+	r := New()
+	err := r.SetGlobalValue("limits", limits{Max: 3, Names: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("SetGlobalValue error: %s", err)
+	}
+	err = r.RegisterFunc("strings.join", func(parts []string, sep string) string {
+		out := ""
+		for i, p := range parts {
+			if i > 0 {
+				out += sep
+			}
+			out += p
+		}
+		return out
+	})
+	if err != nil {
+		t.Fatalf("RegisterFunc error: %s", err)
+	}
+	err = r.RegisterFunc("clamp", func(x, max int) int {
+		if x > max {
+			return max
+		}
+		return x
+	})
+	if err != nil {
+		t.Fatalf("RegisterFunc error: %s", err)
+	}
+
+	result, err := r.Eval(context.Background(), `clamp(10, limits["max"]) + len(limits["names"])`)
+	if err != nil {
+		t.Fatalf("eval error: %s", err)
+	}
+	testIntegerObject(t, result, 5)
+
+	_, err = r.Eval(context.Background(), `clamp("x", 1)`)
+	if err == nil || err.Error() != "argument 1 to `clamp` must be INTEGER, got STRING" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	var out []int
+	result, _ = r.Eval(context.Background(), `map([1, 2], fn(x) { x * 10 })`)
+	if err := object.ToGo(result, &out); err != nil || len(out) != 2 || out[1] != 20 {
+		t.Errorf("ToGo failed. got=%v (%v)", out, err)
+	}
+}
+
+func TestRuntimeLoad(t *testing.T) {
+	compiling := New()
+	compiling.SetGlobalValue("limit", 10)
+	program, err := compiling.Compile(`let double = fn(x) { x * 2 }; double(limit)`)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	data, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error: %s", err)
+	}
+
+	r := New()
+	r.SetGlobalValue("limit", 21)
+	loaded, err := r.Load(data)
+	if err != nil {
+		t.Fatalf("Load error: %s", err)
+	}
+	result, err := r.Run(context.Background(), loaded)
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	testIntegerObject(t, result, 42)
+
+	_, err = r.Load(data[:len(data)-1])
+	if err == nil {
+		t.Errorf("Load accepted truncated bytecode")
+	}
+}
@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// RuntimeError is returned by Run when executing the bytecode fails.
+// It wraps the underlying error and carries the Monkey call stack at the
+// point of failure, innermost frame first.
+type RuntimeError struct {
+	Err   error
+	Trace []TraceFrame
+}
+
+type TraceFrame struct {
+	Function string
+	Line     int
+	Column   int
+}
+
+func (e *RuntimeError) Error() string { return e.Err.Error() }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// maxTraceFrames bounds how many frames StackTrace prints; deep recursion
+// keeps the innermost and outermost frames and elides the middle.
+const maxTraceFrames = 20
+
+func (e *RuntimeError) StackTrace() string {
+	var out bytes.Buffer
+	for i, f := range e.Trace {
+		if len(e.Trace) > maxTraceFrames {
+			half := maxTraceFrames / 2
+			if i == half {
+				fmt.Fprintf(&out, "\t... %d frames omitted ...\n", len(e.Trace)-maxTraceFrames)
+			}
+			if i >= half && i < len(e.Trace)-half {
+				continue
+			}
+		}
+		if f.Line > 0 {
+			fmt.Fprintf(&out, "\tat %s (%d:%d)\n", f.Function, f.Line, f.Column)
+		} else {
+			fmt.Fprintf(&out, "\tat %s\n", f.Function)
+		}
+	}
+	return out.String()
+}
+
+// runtimeError wraps err with the current stack trace unless it already is
+// a *RuntimeError, e.g. from a failed Call that a host function passed on.
+func (vm *VM) runtimeError(err error) *RuntimeError {
+	if rerr, ok := err.(*RuntimeError); ok {
+		return rerr
+	}
+	return vm.newRuntimeError(err)
+}
+
+func (vm *VM) newRuntimeError(err error) *RuntimeError {
+	trace := make([]TraceFrame, 0, vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+		tf := TraceFrame{Function: fn.Name}
+		if tf.Function == "" {
+			tf.Function = "<anonymous>"
+		}
+		if entry, ok := fn.Lines.Lookup(frame.ip); ok {
+			tf.Line = entry.Line
+			tf.Column = entry.Column
+		}
+		trace = append(trace, tf)
+	}
+	return &RuntimeError{Err: err, Trace: trace}
+}
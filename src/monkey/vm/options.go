@@ -0,0 +1,67 @@
+package vm
+
+import "monkey/object"
+
+// Options configures the limits of a VM. Zero values fall back to the
+// package defaults GlobalsSize, MaxFrames and StackSize.
+type Options struct {
+	// StackSize is the most stack slots the VM may use.
+	StackSize int
+	// MaxFrames is the deepest call chain the VM allows.
+	MaxFrames int
+	// GlobalsSize is the number of global slots. Ignored when Globals is set.
+	GlobalsSize int
+
+	// InitialStackSize and InitialFrames are what the VM preallocates.
+	// The stack and the frames grow on demand up to StackSize and MaxFrames.
+	InitialStackSize int
+	InitialFrames    int
+
+	// MaxSteps is the instruction budget. Once the VM has executed that many
+	// instructions it stops with ErrBudgetExceeded. 0 means no limit.
+	MaxSteps int64
+
+	// MaxMemory caps the approximate bytes allocated for arrays, hashes and
+	// strings over the whole run, including those builtins report creating
+	// with object.Track.
+	// Exceeding it stops the VM with ErrMemoryLimit. 0 means no limit.
+	MaxMemory int64
+
+	// Builtins resolves the builtin names recorded in the bytecode.
+	// nil means the default builtins.
+	Builtins *object.Registry
+
+	// Globals is an existing globals store to run against, e.g. to keep
+	// global bindings alive between REPL entries.
+	Globals []object.Object
+}
+
+const (
+	defaultInitialStackSize = 1024
+	defaultInitialFrames    = 64
+)
+
+func (o Options) withDefaults() Options {
+	if o.StackSize <= 0 {
+		o.StackSize = StackSize
+	}
+	if o.MaxFrames <= 0 {
+		o.MaxFrames = MaxFrames
+	}
+	if o.GlobalsSize <= 0 {
+		o.GlobalsSize = GlobalsSize
+	}
+	if o.InitialStackSize <= 0 {
+		o.InitialStackSize = defaultInitialStackSize
+	}
+	if o.InitialStackSize > o.StackSize {
+		o.InitialStackSize = o.StackSize
+	}
+	if o.InitialFrames <= 0 {
+		o.InitialFrames = defaultInitialFrames
+	}
+	if o.InitialFrames > o.MaxFrames {
+		o.InitialFrames = o.MaxFrames
+	}
+	return o
+}
@@ -0,0 +1,168 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+)
+
+// Verify checks bytecode before it is run, so hand-built or corrupted
+// bytecode is rejected with a diagnostic instead of crashing the VM. On
+// top of code.Verify for the main program and every compiled function it
+// checks that operands stay in range: constant indexes, globals against
+// numGlobals, the number of global slots of the VM that will run it,
+// locals against the function's NumLocals, which must have room for its
+// parameters, builtins against the names in
+// the bytecode and free variables against what each OpClosure captures.
+// Functions must return instead of running off their end, and the main
+// program must not return at all.
+func Verify(bytecode *compiler.Bytecode, numGlobals int) error {
+	v := verifier{bytecode: bytecode, numGlobals: numGlobals, numFree: make(map[int]int)}
+
+	// free variable counts come from the OpClosure sites, so collect
+	// them before checking the functions that use them.
+	err := v.collectClosures(bytecode.Instructions, "<main>")
+	if err != nil {
+		return err
+	}
+	for i, constant := range bytecode.Constans {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		err := v.collectClosures(fn.Instructions, functionName(fn, i))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = v.verifyFunction(bytecode.Instructions, "<main>", -1, 0, 0)
+	if err != nil {
+		return err
+	}
+	for i, constant := range bytecode.Constans {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		err := v.verifyFunction(fn.Instructions, functionName(fn, i), i, fn.NumLocals, fn.NumParameters)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type verifier struct {
+	bytecode   *compiler.Bytecode
+	numGlobals int
+	// numFree maps the constant index of a function to the fewest free
+	// variables any OpClosure creating it captures.
+	numFree map[int]int
+}
+
+func functionName(fn *object.CompiledFunction, index int) string {
+	if fn.Name != "" {
+		return fmt.Sprintf("function %s (constant %d)", fn.Name, index)
+	}
+	return fmt.Sprintf("function constant %d", index)
+}
+
+func (v *verifier) collectClosures(ins code.Instructions, name string) error {
+	err := code.Verify(ins)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	for i := 0; i < len(ins); {
+		def, _ := code.Lookup(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		if code.Opcode(ins[i]) == code.OpClosure {
+			index, free := operands[0], operands[1]
+			if n, ok := v.numFree[index]; !ok || free < n {
+				v.numFree[index] = free
+			}
+		}
+		i += 1 + read
+	}
+	return nil
+}
+
+// verifyFunction checks the operands of one function. index is its
+// constant index, -1 for the main program, numLocals bounds its locals and
+// the first numParameters of them hold its arguments.
+func (v *verifier) verifyFunction(ins code.Instructions, name string, index, numLocals, numParameters int) error {
+	fail := func(offset int, format string, a ...interface{}) error {
+		return fmt.Errorf("%s: %w", name, &code.VerifyError{Offset: offset, Message: fmt.Sprintf(format, a...)})
+	}
+	switch {
+	case numLocals < 0:
+		return fail(0, "negative number of locals %d", numLocals)
+	case numParameters < 0:
+		return fail(0, "negative number of parameters %d", numParameters)
+	case numLocals < numParameters:
+		return fail(0, "%d locals cannot hold %d parameters", numLocals, numParameters)
+	}
+	constants := v.bytecode.Constans
+
+	last := code.Opcode(0)
+	for i := 0; i < len(ins); {
+		op := code.Opcode(ins[i])
+		def, _ := code.Lookup(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		switch op {
+		case code.OpConstant:
+			if operands[0] >= len(constants) {
+				return fail(i, "%s: constant %d out of range (%d constants)", def.Name, operands[0], len(constants))
+			}
+		case code.OpClosure:
+			if operands[0] >= len(constants) {
+				return fail(i, "%s: constant %d out of range (%d constants)", def.Name, operands[0], len(constants))
+			}
+			if _, ok := constants[operands[0]].(*object.CompiledFunction); !ok {
+				return fail(i, "%s: constant %d is %s, not a function", def.Name, operands[0], constants[operands[0]].Type())
+			}
+		case code.OpGetAttr, code.OpCallMethod:
+			if operands[0] >= len(constants) {
+				return fail(i, "%s: constant %d out of range (%d constants)", def.Name, operands[0], len(constants))
+			}
+			if _, ok := constants[operands[0]].(*object.String); !ok {
+				return fail(i, "%s: constant %d is %s, not a name", def.Name, operands[0], constants[operands[0]].Type())
+			}
+		case code.OpGetGlobal, code.OpSetGlobal:
+			if operands[0] >= v.numGlobals {
+				return fail(i, "%s: global %d out of range (%d globals)", def.Name, operands[0], v.numGlobals)
+			}
+		case code.OpGetLocal, code.OpSetLocal:
+			if index < 0 {
+				return fail(i, "%s: locals used outside of a function", def.Name)
+			}
+			if operands[0] >= numLocals {
+				return fail(i, "%s: local %d out of range (%d locals)", def.Name, operands[0], numLocals)
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(v.bytecode.Builtins) || v.bytecode.Builtins[operands[0]] == "" {
+				return fail(i, "%s: builtin %d not in bytecode", def.Name, operands[0])
+			}
+		case code.OpGetFree:
+			if operands[0] >= v.numFree[index] {
+				return fail(i, "%s: free variable %d out of range (%d captured)", def.Name, operands[0], v.numFree[index])
+			}
+		case code.OpReturnValue, code.OpReturn:
+			if index < 0 {
+				return fail(i, "%s: return outside of a function", def.Name)
+			}
+		case code.OpJump, code.OpJumpNotTruthy:
+			if index >= 0 && operands[0] == len(ins) {
+				return fail(i, "%s: jumps past the end of the function", def.Name)
+			}
+		}
+		last = op
+		i += 1 + read
+	}
+
+	if index >= 0 && last != code.OpReturnValue && last != code.OpReturn {
+		return fail(len(ins), "function does not end with a return")
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package vm
 
 import (
+	"context"
 	"fmt"
 	"monkey/code"
 	"monkey/compiler"
@@ -11,6 +12,14 @@ const GlobalsSize = 65536
 const MaxFrames = 1024
 const StackSize = 2048
 
+// ErrBudgetExceeded is returned (wrapped in a *RuntimeError) when the VM
+// executes more instructions than Options.MaxSteps allows.
+var ErrBudgetExceeded = object.ErrBudgetExceeded
+
+// ErrMemoryLimit is returned (wrapped in a *RuntimeError) when the arrays,
+// hashes and strings created by the program exceed Options.MaxMemory bytes.
+var ErrMemoryLimit = object.ErrMemoryLimit
+
 type VM struct {
 	constants   []object.Object
 	globals     []object.Object
@@ -18,32 +27,77 @@ type VM struct {
 	sp          int //Always points to the next value. Top of stack is stack[sp-1]
 	frames      []*Frame
 	framesIndex int
+	// stack and frames grow up to these limits.
+	maxStack  int
+	maxFrames int
+	// steps counts executed instructions against maxSteps; 0 means no limit.
+	steps    int64
+	maxSteps int64
+	// allocated approximates the bytes allocated so far, see object.AllocSize.
+	allocated int64
+	maxMemory int64
+	// builtins are resolved from the bytecode's builtin names; nil entries
+	// are names the registry does not know.
+	builtins     []*object.Builtin
+	builtinNames []string
+	// ctx is the context of the current run. Host functions get builtinCtx,
+	// which also carries the VM as an object.Caller and object.Tracker.
+	ctx        context.Context
+	builtinCtx context.Context
 }
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	return NewWithOptions(bytecode, Options{})
+}
+
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	return NewWithOptions(bytecode, Options{Globals: s})
+}
+
+func NewWithOptions(bytecode *compiler.Bytecode, opts Options) *VM {
+	opts = opts.withDefaults()
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Name:         "<main>",
+		Lines:        bytecode.Lines,
+	}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
-	frames := make([]*Frame, MaxFrames)
+	frames := make([]*Frame, opts.InitialFrames)
 	frames[0] = mainFrame
-	return &VM{
-		globals:     make([]object.Object, GlobalsSize),
-		constants:   bytecode.Constans,
-		stack:       make([]object.Object, StackSize),
-		sp:          0,
-		frames:      frames,
-		framesIndex: 1,
+	globals := opts.Globals
+	if globals == nil {
+		globals = make([]object.Object, opts.GlobalsSize)
+	}
+	builtins := make([]*object.Builtin, len(bytecode.Builtins))
+	for i, name := range bytecode.Builtins {
+		builtins[i], _ = opts.Builtins.Lookup(name)
 	}
+	vm := &VM{
+		globals:      globals,
+		constants:    bytecode.Constans,
+		stack:        make([]object.Object, opts.InitialStackSize),
+		sp:           0,
+		frames:       frames,
+		framesIndex:  1,
+		maxStack:     opts.StackSize,
+		maxFrames:    opts.MaxFrames,
+		maxSteps:     opts.MaxSteps,
+		maxMemory:    opts.MaxMemory,
+		builtins:     builtins,
+		builtinNames: bytecode.Builtins,
+	}
+	vm.setContext(context.Background())
+	return vm
 }
 
-func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
-	vm := New(bytecode)
-	vm.globals = s
-	return vm
+func (vm *VM) setContext(ctx context.Context) {
+	vm.ctx = ctx
+	vm.builtinCtx = object.WithTracker(object.WithCaller(ctx, vm), vm)
 }
 
 func (vm *VM) StackTop() object.Object {
@@ -53,11 +107,95 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
+// Run executes the bytecode. Errors are returned as *RuntimeError so the
+// caller can print the Monkey stack trace.
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext is like Run but stops with the context's error once ctx is
+// canceled or its deadline passes.
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.setContext(ctx)
+	err := vm.run(0)
+	if err != nil {
+		return vm.runtimeError(err)
+	}
+	return nil
+}
+
+// Call runs cl with args to completion on top of the current stack and
+// returns its result. Host functions use it to call back into the script
+// while Run is in progress; it also works after Run has finished, e.g. to
+// call a function the script left in a global.
+func (vm *VM) Call(cl *object.Closure, args ...object.Object) (object.Object, error) {
+	base := vm.framesIndex
+	sp := vm.sp
+
+	err := vm.push(cl)
+	for i := 0; err == nil && i < len(args); i++ {
+		err = vm.push(args[i])
+	}
+	if err == nil {
+		err = vm.callClosure(cl, len(args))
+	}
+	if err == nil {
+		err = vm.run(base)
+	}
+	if err != nil {
+		// take the stack trace before unwinding the frames of the call, so
+		// the caller can recover and Run carries on from where it was.
+		rerr := vm.runtimeError(err)
+		vm.framesIndex = base
+		vm.sp = sp
+		return nil, rerr
+	}
+	result := vm.pop()
+	vm.sp = sp
+	return result, nil
+}
+
+// CallFunction implements object.Caller for closures and builtins.
+func (vm *VM) CallFunction(fn object.Object, args ...object.Object) (object.Object, error) {
+	switch fn := fn.(type) {
+	case *object.Closure:
+		return vm.Call(fn, args...)
+	case *object.Builtin:
+		result, err := fn.Call(vm.builtinCtx, args...)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			return Null, nil
+		}
+		if errObj, ok := result.(*object.Error); ok {
+			return nil, errObj
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("calling non-function")
+	}
+}
+
+// run executes instructions until the frame at index base returns.
+// base 0 runs the main program to its end.
+func (vm *VM) run(base int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	ctx := vm.ctx
+	done := ctx.Done()
+	for vm.framesIndex > base && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.steps++
+		if vm.maxSteps > 0 && vm.steps > vm.maxSteps {
+			return ErrBudgetExceeded
+		}
+		if done != nil && vm.steps%object.CtxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
 		vm.currentFrame().ip++
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
@@ -69,6 +207,10 @@ func (vm *VM) Run() error {
 			// e.g. vm.sp =3, numElements = 3
 			// startIndex = 3, endIndex=0
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			err := vm.Track(array)
+			if err != nil {
+				return err
+			}
 			vm.push(array)
 		case code.OpCall:
 			args := int(ins[ip+1])
@@ -128,9 +270,14 @@ func (vm *VM) Run() error {
 		case code.OpGetBuiltin:
 			builtinIndex := int(ins[ip+1])
 			vm.currentFrame().ip++
-			// vm.executeBuiltinOperation(builtinIndex)
-			definition := object.Builtins[builtinIndex]
-			vm.push(definition.Builtin)
+			builtin, err := vm.lookupBuiltin(builtinIndex)
+			if err != nil {
+				return err
+			}
+			err = vm.push(builtin)
+			if err != nil {
+				return err
+			}
 		case code.OpGetFree:
 			freeIndex := int(ins[ip+1])
 			vm.currentFrame().ip++
@@ -149,13 +296,16 @@ func (vm *VM) Run() error {
 			pos := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
 			condition := vm.pop()
-			if !isTruty(condition) {
+			if !object.IsTruthy(condition) {
 				vm.currentFrame().ip = pos - 1
 			}
 		case code.OpGetGlobal:
 			//read index of
 			globalIndex := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
+			if globalIndex >= len(vm.globals) {
+				return fmt.Errorf("too many globals: limit is %d", len(vm.globals))
+			}
 			err := vm.push(vm.globals[globalIndex])
 			if err != nil {
 				return err
@@ -186,6 +336,9 @@ func (vm *VM) Run() error {
 		case code.OpSetGlobal:
 			globalIndex := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
+			if globalIndex >= len(vm.globals) {
+				return fmt.Errorf("too many globals: limit is %d", len(vm.globals))
+			}
 			vm.globals[globalIndex] = vm.pop()
 		case code.OpSetLocal:
 			localIndex := int(ins[ip+1])
@@ -199,6 +352,10 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+			err = vm.Track(hash)
+			if err != nil {
+				return err
+			}
 			vm.sp = vm.sp - numElements
 			err = vm.push(hash)
 			if err != nil {
@@ -226,6 +383,23 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpGetAttr:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			name := vm.constants[constIndex].(*object.String).Value
+			err := vm.executeGetAttr(vm.pop(), name)
+			if err != nil {
+				return err
+			}
+		case code.OpCallMethod:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numArgs := int(ins[ip+3])
+			vm.currentFrame().ip += 3
+			name := vm.constants[constIndex].(*object.String).Value
+			err := vm.executeCallMethod(name, numArgs)
+			if err != nil {
+				return err
+			}
 		}
 
 	}
@@ -248,33 +422,64 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 }
 
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
-	hashedPairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash((endIndex - startIndex) / 2)
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
 
-		pair := object.HashPair{Key: key, Value: value}
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.AsHashable(key)
 
 		if !ok {
 			return nil, fmt.Errorf("unusable as hash key %s", key.Type())
 		}
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey, value)
 	}
-	return &object.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	result, err := builtin.Call(vm.builtinCtx, args...)
+	if err != nil {
+		return err
+	}
 	vm.sp = vm.sp - numArgs - 1
+	return vm.pushResult(result)
+}
 
-	if result != nil {
-		vm.push(result)
-	} else {
-		vm.push(Null)
+func (vm *VM) executeGetAttr(obj object.Object, name string) error {
+	result, err := object.GetAttr(obj, name)
+	if err != nil {
+		return err
 	}
-	return nil
+	return vm.pushResult(result)
+}
+
+// executeCallMethod calls the method name on the receiver below the
+// numArgs arguments on the stack, without materializing a bound method.
+func (vm *VM) executeCallMethod(name string, numArgs int) error {
+	receiver := vm.stack[vm.sp-1-numArgs]
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+	result, err := object.CallMethod(vm.builtinCtx, receiver, name, args...)
+	if err != nil {
+		return err
+	}
+	vm.sp = vm.sp - numArgs - 1
+	return vm.pushResult(result)
+}
+
+// pushResult pushes a value handed back by host code, Null if it is nil.
+// An error object fails the script, as it does on the evaluator. Host code
+// reports the objects it creates itself, see object.Track, so results that
+// already existed are not counted again.
+func (vm *VM) pushResult(result object.Object) error {
+	if result == nil {
+		return vm.push(Null)
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		return errObj
+	}
+	return vm.push(result)
 }
 
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
@@ -283,31 +488,65 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 	}
 
 	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	// locals live on the stack above the base pointer, so they need room
+	// too. Comparing before adding keeps a huge NumLocals from overflowing.
+	if cl.Fn.NumLocals > vm.maxStack-frame.basePointer {
+		return fmt.Errorf("stack overflow")
+	}
+	err := vm.ensureStack(frame.basePointer + cl.Fn.NumLocals)
+	if err != nil {
+		return err
+	}
+	err = vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 	return nil
 }
 
+func (vm *VM) lookupBuiltin(index int) (*object.Builtin, error) {
+	if index >= len(vm.builtins) {
+		return nil, fmt.Errorf("builtin %d not in bytecode", index)
+	}
+	builtin := vm.builtins[index]
+	if builtin == nil {
+		return nil, fmt.Errorf("undefined builtin %s", vm.builtinNames[index])
+	}
+	return builtin, nil
+}
+
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
 
-func isTruty(obj object.Object) bool {
-	switch obj := obj.(type) {
-	case *object.Boolean:
-		return obj.Value
-	case *object.Null:
-		return false
-	default:
-		// integer 0 is also true.
-		return true
+// ensureStack grows the stack so it holds at least size slots.
+func (vm *VM) ensureStack(size int) error {
+	if size <= len(vm.stack) {
+		return nil
+	}
+	if size > vm.maxStack {
+		return fmt.Errorf("stack overflow")
 	}
+	newSize := len(vm.stack) * 2
+	if newSize < size {
+		newSize = size
+	}
+	if newSize > vm.maxStack {
+		newSize = vm.maxStack
+	}
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+	return nil
 }
 
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
-
+	if vm.sp >= len(vm.stack) {
+		err := vm.ensureStack(vm.sp + 1)
+		if err != nil {
+			return err
+		}
 	}
 	vm.stack[vm.sp] = o
 	vm.sp++
@@ -330,9 +569,22 @@ func (vm *VM) pushClosure(constIndex, numFreeVar int) error {
 	return vm.push(closure)
 }
 
-func (vm *VM) pushFrame(f *Frame) {
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= len(vm.frames) {
+		if vm.framesIndex >= vm.maxFrames {
+			return fmt.Errorf("stack overflow: maximum call depth %d exceeded", vm.maxFrames)
+		}
+		newSize := len(vm.frames) * 2
+		if newSize > vm.maxFrames {
+			newSize = vm.maxFrames
+		}
+		frames := make([]*Frame, newSize)
+		copy(frames, vm.frames)
+		vm.frames = frames
+	}
 	vm.frames[vm.framesIndex] = f
 	vm.framesIndex++
+	return nil
 }
 
 func (vm *VM) pop() object.Object {
@@ -350,6 +602,22 @@ func (vm *VM) LastPoppedStackElm() object.Object {
 	return vm.stack[vm.sp]
 }
 
+// MemoryUsed reports the approximate number of bytes the program has
+// allocated for arrays, hashes and strings so far.
+func (vm *VM) MemoryUsed() int64 {
+	return vm.allocated
+}
+
+// Track counts a newly created object against the memory limit. It
+// implements object.Tracker for the host functions the VM calls.
+func (vm *VM) Track(obj object.Object) error {
+	vm.allocated += object.AllocSize(obj)
+	if vm.maxMemory > 0 && vm.allocated > vm.maxMemory {
+		return ErrMemoryLimit
+	}
+	return nil
+}
+
 func (vm *VM) executeArrayIndex(left, index object.Object) error {
 	indexValue := index.(*object.Integer).Value
 	array := left.(*object.Array)
@@ -397,6 +665,9 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftValue / rightValue
 	case code.OpSub:
 		result = leftValue - rightValue
@@ -411,7 +682,12 @@ func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Ob
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 	if op == code.OpAdd {
-		return vm.push(&object.String{Value: leftValue + rightValue})
+		result := &object.String{Value: leftValue + rightValue}
+		err := vm.Track(result)
+		if err != nil {
+			return err
+		}
+		return vm.push(result)
 	}
 	return fmt.Errorf("unknown string operator%d", op)
 }
@@ -438,9 +714,9 @@ func (vm *VM) executeComparision(op code.Opcode) error {
 	var result bool
 	switch op {
 	case code.OpEqual:
-		result = left == right
+		result = object.Equal(left, right)
 	case code.OpNotEqual:
-		result = left != right
+		result = !object.Equal(left, right)
 	default:
 		return fmt.Errorf("unknown bool comparision operator %d", op)
 	}
@@ -449,15 +725,15 @@ func (vm *VM) executeComparision(op code.Opcode) error {
 
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
+	key, ok := object.AsHashable(index)
 	if !ok {
 		return fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return vm.push(Null)
 	}
-	return vm.push(pair.Value)
+	return vm.push(value)
 }
 
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
@@ -466,6 +742,12 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 		return vm.executeArrayIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
+	case object.IsHostObject(left):
+		result, err := left.(object.HostObject).Index(index)
+		if err != nil {
+			return err
+		}
+		return vm.pushResult(result)
 	default:
 		return fmt.Errorf("index operator not supported:%s", left.Type())
 	}
@@ -1,12 +1,17 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"monkey/ast"
+	"monkey/code"
 	"monkey/compiler"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -24,8 +29,18 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		if err != nil {
 			t.Fatalf("compiler error: %s", err)
 		}
+		err = Verify(comp.Bytecode(), GlobalsSize)
+		if err != nil {
+			t.Fatalf("verify error: %s", err)
+		}
 		vm := New(comp.Bytecode())
 		err = vm.Run()
+		if expectedErr, ok := tt.expected.(*object.Error); ok {
+			if err == nil || err.Error() != expectedErr.Message {
+				t.Errorf("wrong VM error for %q. want=%q, got=%v", tt.input, expectedErr.Message, err)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
 		}
@@ -34,6 +49,22 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 
 	}
 }
+
+// newTestVM compiles input with the builtins of r, nil meaning the default
+// ones, and returns a VM for the bytecode created with opts.
+func newTestVM(t *testing.T, input string, r *object.Registry, opts Options) *VM {
+	t.Helper()
+	if r == nil {
+		r = object.NewRegistry()
+	}
+	comp := compiler.NewWithBuiltins(r)
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return NewWithOptions(comp.Bytecode(), opts)
+}
+
 func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) {
 	t.Helper()
 	switch expected := expected.(type) {
@@ -78,14 +109,15 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
 			return
 		}
-		if len(hash.Pairs) != len(expected) {
-			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), len(hash.Pairs))
+		if hash.Len() != len(expected) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), hash.Len())
 			return
 		}
-		for expectedKey, expectedValue := range expected {
-			pair, ok := hash.Pairs[expectedKey]
+		for _, pair := range hash.Pairs() {
+			expectedValue, ok := expected[pair.Key.(object.Hashable).HashKey()]
 			if !ok {
-				t.Errorf("no pair for given key in Pairs")
+				t.Errorf("unexpected key %s in Pairs", pair.Key.Inspect())
+				continue
 			}
 			err := testIntegerObject(expectedValue, pair.Value)
 			if err != nil {
@@ -183,10 +215,119 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`push(1, 1)`,
 			&object.Error{Message: "argument to `push` must be ARRAY, got INTEGER"},
 		},
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`map([[1], [1, 2]], len)`, []int{1, 2}},
+		{`let offset = 10; map([1, 2], fn(x) { x + offset })`, []int{11, 12}},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`reduce([], 7, fn(acc, x) { acc + x })`, 7},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, []int{3, 2, 1}},
+		{`sort([1, "a"])`,
+			&object.Error{Message: "`sort` without a function needs all INTEGER or all STRING, got STRING"},
+		},
+		{`let sum = fn(arr) { reduce(arr, 0, fn(a, b) { a + b }) }; map([[1, 2], [3]], sum)`, []int{3, 3}},
 	}
 	runVmTests(t, tests)
 }
 
+func TestCallFromHost(t *testing.T) {
+	program := parse(`let add = fn(a, b) { a + b }; let broken = fn() { 1(); }; add(1, 2);`)
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	add := vm.globals[0].(*object.Closure)
+	result, err := vm.Call(add, &object.Integer{Value: 20}, &object.Integer{Value: 22})
+	if err != nil {
+		t.Fatalf("Call error: %s", err)
+	}
+	testExpectedObject(t, 42, result)
+
+	_, err = vm.Call(add, &object.Integer{Value: 1})
+	if err == nil || err.Error() != "wrong number of arguments: want=2, got=1" {
+		t.Errorf("wrong Call error. got=%v", err)
+	}
+
+	broken := vm.globals[1].(*object.Closure)
+	_, err = vm.Call(broken)
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%+v)", err, err)
+	}
+	if len(rerr.Trace) != 2 || rerr.Trace[0].Function != "broken" {
+		t.Errorf("wrong trace. got=%+v", rerr.Trace)
+	}
+
+	// the VM is still usable after a failed call.
+	result, err = vm.Call(add, &object.Integer{Value: 1}, &object.Integer{Value: 1})
+	if err != nil {
+		t.Fatalf("Call error: %s", err)
+	}
+	testExpectedObject(t, 2, result)
+}
+
+func TestCallbackErrorStackTrace(t *testing.T) {
+	program := parse(`let f = fn(x) { x() }; map([1], f);`)
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%+v)", err, err)
+	}
+	expected := "\tat f (1:18)\n\tat <main> (1:27)\n"
+	if rerr.StackTrace() != expected {
+		t.Errorf("wrong stack trace.\nwant=%q\ngot=%q", expected, rerr.StackTrace())
+	}
+}
+
+func TestCallbackErrorRecovery(t *testing.T) {
+	// try calls its argument and falls back to its second one on error.
+	registry := object.NewRegistry()
+	registry.Register("try", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		caller, _ := object.CallerFrom(ctx)
+		result, err := caller.CallFunction(args[0])
+		if err != nil {
+			return args[1], nil
+		}
+		return result, nil
+	})
+	continued := 0
+	registry.Register("mark", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		continued++
+		return nil, nil
+	})
+
+	input := `let bad = fn() { let x = 1(); mark() };
+	let good = fn() { try(bad, "recovered") };
+	[good(), try(fn() { 2 }, 0), try(fn() { try(bad, 3) + true }, 4)]`
+	vm := newTestVM(t, input, registry, Options{Builtins: registry})
+	err := vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if vm.LastPoppedStackElm().Inspect() != "[recovered, 2, 4]" {
+		t.Errorf("wrong result. got=%s", vm.LastPoppedStackElm().Inspect())
+	}
+	if continued != 0 {
+		t.Errorf("failed function ran on after its error %d times", continued)
+	}
+	if vm.sp != 0 || vm.framesIndex != 1 {
+		t.Errorf("VM not unwound. sp=%d, framesIndex=%d", vm.sp, vm.framesIndex)
+	}
+}
+
 func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -288,6 +429,23 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	}
 }
 
+func TestHashLiteralEvaluationOrder(t *testing.T) {
+	program := parse(`{"b": 1 + true, "a": -true}`)
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+	if !strings.HasPrefix(err.Error(), "unsupported types for binary operation") {
+		t.Fatalf("pairs not evaluated in source order. got error %q", err)
+	}
+}
+
 func TestCallingFunctionsWithoutArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -444,6 +602,10 @@ func TestIndexExpressions(t *testing.T) {
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
 		{"{}[0]", Null},
+		{"{[1, 2]: 1, [2, 1]: 2}[[2, 1]]", 2},
+		{`{{"a": [true]}: 1}[{"a": [true]}]`, 1},
+		{"{[1]: 1}.has([1])", true},
+		{"{[1]: 1, [1]: 2}.len()", 1},
 	}
 	runVmTests(t, tests)
 }
@@ -466,6 +628,7 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"-10", -10},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 / (5 - 5)", &object.Error{Message: "division by zero"}},
 	}
 	runVmTests(t, tests)
 }
@@ -502,6 +665,24 @@ func TestBooleanExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestStructuralEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{`"a" == "a"`, true},
+		{`"a" + "b" != "ab"`, false},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, true},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, 2] != [1, 2, 3]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`let x = if (false) { 1 }; x == if (false) { 2 }`, true},
+		{`[] == {}`, false},
+		{`1 == "1"`, false},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`let f = fn() { 1 }; f == f`, true},
+	}
+	runVmTests(t, tests)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []vmTestCase{
 		{"if (true) { 10 }", 10},
@@ -626,3 +807,530 @@ func TestStringExpressions(t *testing.T) {
 	}
 	runVmTests(t, tests)
 }
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	input := `let callIt = fn(f) {
+  f()
+};
+let run = fn() { callIt(1) };
+run();`
+
+	program := parse(input)
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%+v)", err, err)
+	}
+	if rerr.Error() != "calling non-function" {
+		t.Errorf("wrong VM error: want=%q, got=%q", "calling non-function", rerr.Error())
+	}
+	expected := "\tat callIt (2:4)\n\tat run (4:24)\n\tat <main> (5:4)\n"
+	if rerr.StackTrace() != expected {
+		t.Errorf("wrong stack trace.\nwant=%q\ngot=%q", expected, rerr.StackTrace())
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `let f = fn() { f() }; f();`,
+			expected: `stack overflow: maximum call depth 1024 exceeded`,
+		},
+		{
+			input: `
+			let f = fn(x) {
+				let a = 1; let b = 2; let c = 3; let d = 4; let e = 5;
+				let g = 6; let h = 7; let i = 8; let j = 9; let k = 10;
+				f(x + 1) + a + b + c + d + e + g + h + i + j + k
+			};
+			f(0);`,
+			expected: `stack overflow`,
+		},
+	}
+	for _, tt := range tests {
+		vm := newTestVM(t, tt.input, nil, Options{})
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestHugeNumLocals(t *testing.T) {
+	// Verify accepts any NumLocals that holds the parameters, so the VM
+	// must not let a huge one overflow the stack bounds.
+	fn := &object.CompiledFunction{Instructions: code.Make(code.OpReturn), NumLocals: math.MaxInt64}
+	ins := code.Instructions{}
+	ins = append(ins, code.Make(code.OpClosure, 0, 0)...)
+	ins = append(ins, code.Make(code.OpCall, 0)...)
+	ins = append(ins, code.Make(code.OpPop)...)
+	bytecode := &compiler.Bytecode{Instructions: ins, Constans: []object.Object{fn}}
+
+	err := Verify(bytecode, GlobalsSize)
+	if err != nil {
+		t.Fatalf("verify error: %s", err)
+	}
+	err = New(bytecode).Run()
+	if err == nil || err.Error() != "stack overflow" {
+		t.Fatalf("wrong VM error: want=%q, got=%v", "stack overflow", err)
+	}
+}
+
+func TestVMOptions(t *testing.T) {
+	countDown := `
+	let countDown = fn(x) { if (x == 0) { 0 } else { countDown(x - 1) } };
+	countDown(5000);`
+	tests := []struct {
+		input       string
+		opts        Options
+		expected    interface{}
+		expectedErr string
+	}{
+		{
+			input:       countDown,
+			opts:        Options{},
+			expectedErr: "stack overflow",
+		},
+		{
+			input:    countDown,
+			opts:     Options{MaxFrames: 6000, StackSize: 30000},
+			expected: 0,
+		},
+		{
+			input:       `let f = fn(x) { x }; f(f(f(1)));`,
+			opts:        Options{MaxFrames: 1},
+			expectedErr: "stack overflow: maximum call depth 1 exceeded",
+		},
+		{
+			input:       `1 + 2 + 3`,
+			opts:        Options{StackSize: 1},
+			expectedErr: "stack overflow",
+		},
+		{
+			input:       `let a = 1; let b = 2; a + b`,
+			opts:        Options{GlobalsSize: 1},
+			expectedErr: "too many globals: limit is 1",
+		},
+		{
+			input:    `let a = 1; let b = 2; a + b`,
+			opts:     Options{GlobalsSize: 2, StackSize: 2, InitialStackSize: 1, InitialFrames: 1},
+			expected: 3,
+		},
+	}
+	for _, tt := range tests {
+		vm := newTestVM(t, tt.input, nil, tt.opts)
+		err := vm.Run()
+		if tt.expectedErr != "" {
+			if err == nil {
+				t.Fatalf("expected VM error but resulted in none.")
+			}
+			if err.Error() != tt.expectedErr {
+				t.Fatalf("wrong VM error: want=%q, got=%q", tt.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElm())
+	}
+}
+
+func TestBudgetAndCancellation(t *testing.T) {
+	input := `
+	let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } };
+	fib(25);`
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		ctx         context.Context
+		opts        Options
+		expectedErr error
+	}{
+		{context.Background(), Options{MaxSteps: 1000}, ErrBudgetExceeded},
+		{canceled, Options{}, context.Canceled},
+		{context.Background(), Options{MaxSteps: 10000000}, nil},
+	}
+	for _, tt := range tests {
+		vm := newTestVM(t, input, nil, tt.opts)
+		err := vm.RunContext(tt.ctx)
+		if tt.expectedErr == nil {
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			testExpectedObject(t, 75025, vm.LastPoppedStackElm())
+			continue
+		}
+		if !errors.Is(err, tt.expectedErr) {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expectedErr, err)
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		input       string
+		opts        Options
+		expectedErr error
+	}{
+		{
+			input: `
+			let build = fn(arr, n) { if (n == 0) { arr } else { build(push(arr, n), n - 1) } };
+			build([], 500);`,
+			opts:        Options{MaxMemory: 100000},
+			expectedErr: ErrMemoryLimit,
+		},
+		{
+			input: `
+			let grow = fn(s, n) { if (n == 0) { s } else { grow(s + s, n - 1) } };
+			grow("ab", 40);`,
+			opts:        Options{MaxMemory: 1 << 20},
+			expectedErr: ErrMemoryLimit,
+		},
+		{
+			input:       `[[1, 2, 3], [4, 5, 6], {"a": [7, 8, 9]}]`,
+			opts:        Options{MaxMemory: 100},
+			expectedErr: ErrMemoryLimit,
+		},
+		{
+			input: `
+			let grow = fn(s, n) { if (n == 0) { s } else { grow(s + s, n - 1) } };
+			len(grow("ab", 10));`,
+			opts:        Options{MaxMemory: 1 << 20},
+			expectedErr: nil,
+		},
+		{
+			// first returns an existing string, which is not counted again
+			input: `
+			let a = ["xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx"];
+			let loop = fn(n) { if (n == 0) { 0 } else { first(a); a.first(); loop(n - 1) } };
+			loop(500);`,
+			opts:        Options{MaxMemory: 20000},
+			expectedErr: nil,
+		},
+		{
+			input: `
+			let s = "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx";
+			let loop = fn(n) { if (n == 0) { 0 } else { s.upper(); loop(n - 1) } };
+			loop(500);`,
+			opts:        Options{MaxMemory: 20000},
+			expectedErr: ErrMemoryLimit,
+		},
+	}
+	for _, tt := range tests {
+		vm := newTestVM(t, tt.input, nil, tt.opts)
+		err := vm.Run()
+		if tt.expectedErr == nil {
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			if vm.MemoryUsed() <= 0 {
+				t.Errorf("memory use not accounted. got=%d", vm.MemoryUsed())
+			}
+			continue
+		}
+		if !errors.Is(err, tt.expectedErr) {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expectedErr, err)
+		}
+	}
+}
+
+func TestHostBuiltins(t *testing.T) {
+	compileRegistry := object.NewRegistry()
+	compileRegistry.Register("double", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}, nil
+	})
+	compileRegistry.Register("fail", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return nil, errors.New("host failure")
+	})
+
+	// the VM's registry has the same names in a different order.
+	runRegistry := object.NewRegistry()
+	runRegistry.Register("fail", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return nil, errors.New("host failure")
+	})
+	runRegistry.Register("double", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}, nil
+	})
+
+	tests := []struct {
+		input       string
+		registry    *object.Registry
+		expected    interface{}
+		expectedErr string
+	}{
+		{`double(len("four"))`, runRegistry, 8, ""},
+		{`fail()`, runRegistry, nil, "host failure"},
+		{`double(2)`, object.NewRegistry(), nil, "undefined builtin double"},
+	}
+	for _, tt := range tests {
+		vm := newTestVM(t, tt.input, compileRegistry, Options{Builtins: tt.registry})
+		err := vm.Run()
+		if tt.expectedErr != "" {
+			if err == nil || err.Error() != tt.expectedErr {
+				t.Fatalf("wrong VM error: want=%q, got=%v", tt.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElm())
+	}
+}
+
+type testRequest struct {
+	path    string
+	headers map[string]string
+}
+
+func (r *testRequest) Type() object.ObjectType { return "REQUEST" }
+func (r *testRequest) Inspect() string         { return "request " + r.path }
+
+func (r *testRequest) GetAttr(name string) (object.Object, error) {
+	if name == "path" {
+		return &object.String{Value: r.path}, nil
+	}
+	return nil, fmt.Errorf("request has no attribute %s", name)
+}
+
+func (r *testRequest) SetAttr(name string, value object.Object) error {
+	return fmt.Errorf("request is read-only")
+}
+
+func (r *testRequest) CallMethod(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	if name != "header" || len(args) != 1 {
+		return nil, fmt.Errorf("request has no method %s/%d", name, len(args))
+	}
+	value, ok := r.headers[args[0].Inspect()]
+	if !ok {
+		return nil, nil
+	}
+	return &object.String{Value: value}, nil
+}
+
+func (r *testRequest) Index(key object.Object) (object.Object, error) {
+	return r.CallMethod(context.Background(), "header", key)
+}
+
+func TestHostObjects(t *testing.T) {
+	registry := object.NewRegistry()
+	registry.Register("request", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return &testRequest{path: "/", headers: map[string]string{"x": "1"}}, nil
+	})
+	registry.Register("http.status", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return &object.Integer{Value: 200}, nil
+	})
+
+	tests := []struct {
+		input       string
+		expected    interface{}
+		expectedErr string
+	}{
+		{`request().header("x")`, "1", ""},
+		{`let req = request(); req.path + req["x"]`, "/1", ""},
+		{`let f = fn(r) { r.header("y") }; f(request())`, Null, ""},
+		{`http.status()`, 200, ""},
+		{`let http = request(); http.status()`, nil, "request has no method status/0"},
+		{`request().body`, nil, "request has no attribute body"},
+		{`[1].missing`, nil, "ARRAY has no attribute missing"},
+		{`5.abs()`, nil, "INTEGER has no method abs"},
+	}
+	for _, tt := range tests {
+		vm := newTestVM(t, tt.input, registry, Options{Builtins: registry})
+		err := vm.Run()
+		if tt.expectedErr != "" {
+			if err == nil || err.Error() != tt.expectedErr {
+				t.Fatalf("wrong VM error: want=%q, got=%v", tt.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElm())
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{`"Monkey".upper()`, "MONKEY"},
+		{`" a b ".trim().split(" ").len()`, 2},
+		{`"abc".contains("b")`, true},
+		{`[3, 1, 2].sort().map(fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`[1, 2, 3].join("-")`, "1-2-3"},
+		{`[1, 2].push(3).reduce(0, fn(acc, x) { acc + x })`, 6},
+		{`[].first()`, Null},
+		{`{"a": 1}.keys().first()`, "a"},
+		{`{"a": 1}.values()`, []int{1}},
+		{`{"a": 1}.has("b")`, false},
+		{`{"c": 1, "a": 2, "b": 3}.values()`, []int{1, 2, 3}},
+		{`{"c": 1, "a": 2, "b": 3, "a": 4}.values()`, []int{1, 4, 3}},
+		{`let upper = "abc".upper; upper()`, "ABC"},
+		{`let a = [1]; let f = fn(x) { a.push(x) }; f(2).len()`, 2},
+		{`"abc".upper(1)`, &object.Error{Message: "wrong number of arguments. got=1, want=0"}},
+		{`[1].sort(1, 2)`, &object.Error{Message: "wrong number of arguments. got=2, want=0 or 1"}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestRunUnmarshaledBytecode(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let add = fn(a, b) { a + b }; add(len("four"), 3)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	data, err := comp.Bytecode().MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %s", err)
+	}
+	bytecode := &compiler.Bytecode{}
+	err = bytecode.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatalf("UnmarshalBinary failed: %s", err)
+	}
+
+	vm := New(bytecode)
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 7, vm.LastPoppedStackElm())
+}
+
+func TestVerify(t *testing.T) {
+	concat := func(ins ...[]byte) code.Instructions {
+		out := code.Instructions{}
+		for _, in := range ins {
+			out = append(out, in...)
+		}
+		return out
+	}
+	function := func(numLocals int, ins ...[]byte) *object.CompiledFunction {
+		return &object.CompiledFunction{Instructions: concat(ins...), NumLocals: numLocals}
+	}
+
+	tests := []struct {
+		name     string
+		bytecode *compiler.Bytecode
+		expected string
+	}{
+		{
+			name: "constant out of range",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpConstant, 1), code.Make(code.OpPop)),
+				Constans:     []object.Object{&object.Integer{Value: 1}},
+			},
+			expected: "<main>: offset 0: OpConstant: constant 1 out of range (1 constants)",
+		},
+		{
+			name: "closure over a non-function",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)),
+				Constans:     []object.Object{&object.Integer{Value: 1}},
+			},
+			expected: "<main>: offset 0: OpClosure: constant 0 is INTEGER, not a function",
+		},
+		{
+			name: "builtin not in bytecode",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpGetBuiltin, 1), code.Make(code.OpPop)),
+				Builtins:     []string{"len"},
+			},
+			expected: "<main>: offset 0: OpGetBuiltin: builtin 1 not in bytecode",
+		},
+		{
+			name: "local out of range",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)),
+				Constans: []object.Object{
+					function(1, code.Make(code.OpGetLocal, 1), code.Make(code.OpReturnValue)),
+				},
+			},
+			expected: "function constant 0: offset 0: OpGetLocal: local 1 out of range (1 locals)",
+		},
+		{
+			name: "free variable not captured",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpNull), code.Make(code.OpClosure, 0, 1), code.Make(code.OpPop)),
+				Constans: []object.Object{
+					function(0, code.Make(code.OpGetFree, 1), code.Make(code.OpReturnValue)),
+				},
+			},
+			expected: "function constant 0: offset 0: OpGetFree: free variable 1 out of range (1 captured)",
+		},
+		{
+			name: "function without return",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)),
+				Constans: []object.Object{
+					&object.CompiledFunction{Name: "f", Instructions: concat(code.Make(code.OpNull), code.Make(code.OpPop))},
+				},
+			},
+			expected: "function f (constant 0): offset 2: function does not end with a return",
+		},
+		{
+			name: "stack underflow in a function",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)),
+				Constans:     []object.Object{function(0, code.Make(code.OpReturnValue))},
+			},
+			expected: "function constant 0: offset 0: OpReturnValue: stack underflow, needs 1 values, has 0",
+		},
+		{
+			name: "return from the main program",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpNull), code.Make(code.OpReturnValue)),
+			},
+			expected: "<main>: offset 1: OpReturnValue: return outside of a function",
+		},
+		{
+			name: "negative number of locals",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpCall, 0), code.Make(code.OpPop)),
+				Constans:     []object.Object{function(-3, code.Make(code.OpReturn))},
+			},
+			expected: "function constant 0: offset 0: negative number of locals -3",
+		},
+		{
+			name: "fewer locals than parameters",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)),
+				Constans: []object.Object{
+					&object.CompiledFunction{Instructions: code.Make(code.OpReturn), NumParameters: 2, NumLocals: 1},
+				},
+			},
+			expected: "function constant 0: offset 0: 1 locals cannot hold 2 parameters",
+		},
+		{
+			name: "global out of range",
+			bytecode: &compiler.Bytecode{
+				Instructions: concat(code.Make(code.OpNull), code.Make(code.OpSetGlobal, 2)),
+			},
+			expected: "<main>: offset 1: OpSetGlobal: global 2 out of range (2 globals)",
+		},
+	}
+
+	for _, tt := range tests {
+		err := Verify(tt.bytecode, 2)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+		var verifyErr *code.VerifyError
+		if !errors.As(err, &verifyErr) {
+			t.Errorf("%s: error is not a *code.VerifyError", tt.name)
+		}
+	}
+}